@@ -0,0 +1,384 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// sourceFile is a file or directory of a source tree. Archives are expanded
+// into directories of their members, so a member is a sourceFile too.
+type sourceFile struct {
+	// path names the file in messages: its path or, for an archive member,
+	// the path of the archive joined with the name of the member.
+	path string
+	// relPath is the path below the source directory, with each archive as
+	// a directory of the same name.
+	relPath string
+	isDir   bool
+	// open returns the contents of a file.
+	open func() (io.ReadCloser, error)
+}
+
+// archiveKind returns "zip" or "tar" for the files walkSources expands, and
+// "" for any other file. Tar archives may be gzip or bzip2 compressed.
+func archiveKind(name string) string {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return "zip"
+	case strings.HasSuffix(trimCompressionExt(name), ".tar"), strings.HasSuffix(name, ".tgz"), strings.HasSuffix(name, ".tbz2"):
+		return "tar"
+	}
+	return ""
+}
+
+// walkSources walks srcDir like filepath.Walk, calling fn for every directory
+// and file in lexical order. Zip and tar archives are not passed to fn
+// themselves: each is a directory of the same name holding its members, in
+// the order they are stored, and the directories they are stored in.
+// Archives inside archives are not expanded.
+func walkSources(srcDir string, fn func(src sourceFile) error) error {
+	return filepath.Walk(srcDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(srcDir, filePath)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return fn(sourceFile{path: filePath, relPath: relPath, isDir: true})
+		}
+		switch archiveKind(info.Name()) {
+		case "zip":
+			return walkZip(filePath, relPath, fn)
+		case "tar":
+			return walkTar(filePath, relPath, fn)
+		}
+		return fn(sourceFile{path: filePath, relPath: relPath, open: func() (io.ReadCloser, error) {
+			return os.Open(filePath)
+		}})
+	})
+}
+
+// archiveWalker passes the members of an archive to a walkSources callback.
+type archiveWalker struct {
+	path, relPath string
+	fn            func(src sourceFile) error
+	// dirs holds the member directories passed to fn so far.
+	dirs map[string]bool
+}
+
+func newArchiveWalker(archivePath, relPath string, fn func(src sourceFile) error) *archiveWalker {
+	return &archiveWalker{path: archivePath, relPath: relPath, fn: fn, dirs: make(map[string]bool)}
+}
+
+// memberPath cleans the name of a member. Names that would lead out of the
+// archive's directory are rejected, as the destination tree mirrors them.
+func (w *archiveWalker) memberPath(name string) (string, error) {
+	clean := path.Clean(name)
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("%s: member %q is outside the archive", w.path, name)
+	}
+	return clean, nil
+}
+
+// dir passes a member directory to fn, after its parents and unless it was passed before.
+func (w *archiveWalker) dir(name string) error {
+	if w.dirs[name] {
+		return nil
+	}
+	if name != "." {
+		if err := w.dir(path.Dir(name)); err != nil {
+			return err
+		}
+	}
+	w.dirs[name] = true
+	return w.fn(sourceFile{
+		path:    filepath.Join(w.path, filepath.FromSlash(name)),
+		relPath: filepath.Join(w.relPath, filepath.FromSlash(name)),
+		isDir:   true,
+	})
+}
+
+// file passes a member file to fn, after the directories it is in.
+func (w *archiveWalker) file(name string, open func() (io.ReadCloser, error)) error {
+	if err := w.dir(path.Dir(name)); err != nil {
+		return err
+	}
+	return w.fn(sourceFile{
+		path:    filepath.Join(w.path, filepath.FromSlash(name)),
+		relPath: filepath.Join(w.relPath, filepath.FromSlash(name)),
+		open:    open,
+	})
+}
+
+// walkZip passes the members of a zip archive to fn. Members are read
+// directly from the archive, in any order.
+func walkZip(archivePath, relPath string, fn func(src sourceFile) error) error {
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return fmt.Errorf("%s: %v", archivePath, err)
+	}
+	defer zr.Close()
+
+	w := newArchiveWalker(archivePath, relPath, fn)
+	if err := w.dir("."); err != nil {
+		return err
+	}
+	for i, f := range zr.File {
+		name, err := w.memberPath(f.Name)
+		if err != nil {
+			return err
+		}
+		switch {
+		case f.FileInfo().IsDir():
+			err = w.dir(name)
+		case f.Mode().IsRegular():
+			index := i
+			err = w.file(name, func() (io.ReadCloser, error) { return openZipMember(archivePath, index) })
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// zipMember is an open member of a zip archive; closing it closes the archive.
+type zipMember struct {
+	io.ReadCloser
+	archive *zip.ReadCloser
+}
+
+func (m zipMember) Close() error {
+	err := m.ReadCloser.Close()
+	if closeErr := m.archive.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// openZipMember opens the index-th member of a zip archive.
+func openZipMember(archivePath string, index int) (io.ReadCloser, error) {
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	if index >= len(zr.File) {
+		zr.Close()
+		return nil, fmt.Errorf("%s: member %d is missing", archivePath, index)
+	}
+	rc, err := zr.File[index].Open()
+	if err != nil {
+		zr.Close()
+		return nil, err
+	}
+	return zipMember{ReadCloser: rc, archive: zr}, nil
+}
+
+// walkTar lists the members of a tar archive and passes them to fn.
+func walkTar(archivePath, relPath string, fn func(src sourceFile) error) error {
+	cur, err := openTarCursor(archivePath)
+	if err != nil {
+		return err
+	}
+	type member struct {
+		name  string
+		index int
+		isDir bool
+	}
+	var members []member
+	for {
+		hdr, err := cur.tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			cur.file.Close()
+			return fmt.Errorf("%s: %v", archivePath, err)
+		}
+		cur.next++
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			members = append(members, member{name: hdr.Name, index: cur.next - 1, isDir: true})
+		case tar.TypeReg:
+			members = append(members, member{name: hdr.Name, index: cur.next - 1})
+		}
+	}
+	cur.file.Close()
+
+	archive := &tarArchive{path: archivePath, last: -1}
+	for _, m := range members {
+		if !m.isDir {
+			archive.last = m.index
+		}
+	}
+	defer archive.walked()
+	w := newArchiveWalker(archivePath, relPath, fn)
+	if err := w.dir("."); err != nil {
+		return err
+	}
+	for _, m := range members {
+		name, err := w.memberPath(m.name)
+		if err != nil {
+			return err
+		}
+		if m.isDir {
+			err = w.dir(name)
+		} else {
+			index := m.index
+			err = w.file(name, func() (io.ReadCloser, error) { return archive.open(index) })
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maxIdleTarCursors is how many positioned readers a tar archive keeps for reuse.
+const maxIdleTarCursors = 4
+
+// tarArchive opens the members of a tar archive. A tar archive, and certainly
+// a compressed one, can only be read from the start, so it keeps the readers
+// of closed members to open later members from where they stopped. Members
+// opened in archive order, as the passes of the cleaner do, are therefore
+// read without going back to the start each time. Once the walk is over
+// and no member is open, the kept readers are closed.
+type tarArchive struct {
+	path string
+	// last is the index of the last file member; cursors past it are closed.
+	last int
+	mu   sync.Mutex
+	idle []*tarCursor
+	// members counts the members opened and not closed yet.
+	members int
+	// done is set when every member has been passed to the walk callback.
+	done bool
+}
+
+// tarCursor reads a tar archive from the start; next is the index of the
+// entry the next call to tr.Next returns.
+type tarCursor struct {
+	file *os.File
+	tr   *tar.Reader
+	next int
+}
+
+func openTarCursor(archivePath string) (*tarCursor, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	in, _, err := openDecompressed(f, archivePath)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", archivePath, err)
+	}
+	return &tarCursor{file: f, tr: tar.NewReader(in)}, nil
+}
+
+// open returns the contents of the index-th entry of the archive.
+func (a *tarArchive) open(index int) (io.ReadCloser, error) {
+	// Take the idle cursor closest before the entry.
+	var cur *tarCursor
+	a.mu.Lock()
+	best := -1
+	for i, c := range a.idle {
+		if c.next <= index && (best < 0 || c.next > a.idle[best].next) {
+			best = i
+		}
+	}
+	if best >= 0 {
+		cur = a.idle[best]
+		a.idle = append(a.idle[:best], a.idle[best+1:]...)
+	}
+	a.mu.Unlock()
+
+	if cur == nil {
+		var err error
+		if cur, err = openTarCursor(a.path); err != nil {
+			return nil, err
+		}
+	}
+	for cur.next <= index {
+		if _, err := cur.tr.Next(); err != nil {
+			cur.file.Close()
+			if err == io.EOF {
+				return nil, fmt.Errorf("%s: member %d is missing", a.path, index)
+			}
+			return nil, fmt.Errorf("%s: %v", a.path, err)
+		}
+		cur.next++
+	}
+	a.mu.Lock()
+	a.members++
+	a.mu.Unlock()
+	return &tarMember{archive: a, cursor: cur}, nil
+}
+
+// release keeps a cursor for reuse, or closes it if it is past the last
+// file member or enough cursors are kept already.
+func (a *tarArchive) release(cur *tarCursor) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.members--
+	var err error
+	if cur.next > a.last || len(a.idle) >= maxIdleTarCursors {
+		err = cur.file.Close()
+	} else {
+		a.idle = append(a.idle, cur)
+	}
+	if a.done && a.members == 0 {
+		a.closeIdle()
+	}
+	return err
+}
+
+// walked records that the walk has passed every member on, and closes the
+// kept cursors unless a member is still open. Members may still be opened
+// afterwards, by workers the walk handed them to; their cursors are closed
+// when the last of them is.
+func (a *tarArchive) walked() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.done = true
+	if a.members == 0 {
+		a.closeIdle()
+	}
+}
+
+// closeIdle closes the kept cursors; a.mu must be held.
+func (a *tarArchive) closeIdle() {
+	for _, cur := range a.idle {
+		cur.file.Close()
+	}
+	a.idle = nil
+}
+
+// tarMember is an open member of a tar archive.
+type tarMember struct {
+	archive *tarArchive
+	cursor  *tarCursor
+}
+
+func (m *tarMember) Read(p []byte) (int, error) {
+	return m.cursor.tr.Read(p)
+}
+
+func (m *tarMember) Close() error {
+	if m.cursor == nil {
+		return nil
+	}
+	cur := m.cursor
+	m.cursor = nil
+	return m.archive.release(cur)
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testMember is a member of an archive written by writeZip or writeTar; a
+// name ending in "/" is a directory.
+type testMember struct {
+	name, body string
+}
+
+func writeZip(t *testing.T, archivePath string, members []testMember) {
+	t.Helper()
+	f, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, m := range members {
+		w, err := zw.Create(m.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(w, m.body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTar writes a tar archive, gzip compressed if the name ends in .gz.
+func writeTar(t *testing.T, archivePath string, members []testMember) {
+	t.Helper()
+	f, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var w io.Writer = f
+	if strings.HasSuffix(archivePath, ".gz") {
+		gw := gzip.NewWriter(f)
+		defer gw.Close()
+		w = gw
+	}
+	tw := tar.NewWriter(w)
+	for _, m := range members {
+		hdr := &tar.Header{Name: m.name, Mode: 0644, Size: int64(len(m.body)), Typeflag: tar.TypeReg}
+		if strings.HasSuffix(m.name, "/") {
+			hdr.Mode, hdr.Typeflag = 0755, tar.TypeDir
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(tw, m.body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// walkedSources returns what walkSources passes to fn: the relative path of
+// each directory with a trailing "/", and of each file with its contents.
+func walkedSources(t *testing.T, srcDir string) ([]string, error) {
+	t.Helper()
+	var walked []string
+	err := walkSources(srcDir, func(src sourceFile) error {
+		relPath := filepath.ToSlash(src.relPath)
+		if src.isDir {
+			walked = append(walked, relPath+"/")
+			return nil
+		}
+		rc, err := src.open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		body, err := io.ReadAll(rc)
+		if err != nil {
+			return err
+		}
+		walked = append(walked, relPath+"="+string(body))
+		return nil
+	})
+	return walked, err
+}
+
+func TestWalkSources(t *testing.T) {
+	srcDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeZip(t, filepath.Join(srcDir, "b.zip"), []testMember{
+		{"x.txt", "x"},
+		{"sub/", ""},
+		{"sub/y.txt", "y"},
+		// A member whose directory has no entry of its own.
+		{"deep/er/z.txt", "z"},
+	})
+	writeTar(t, filepath.Join(srcDir, "c.tar.gz"), []testMember{
+		{"dir/", ""},
+		{"dir/m1.txt", "m1"},
+		{"./m2.txt", "m2"},
+	})
+	writeTar(t, filepath.Join(srcDir, "d.TAR"), []testMember{
+		{"n.txt", "n"},
+		{"empty.txt", ""},
+	})
+
+	walked, err := walkedSources(t, srcDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"./",
+		"a.txt=a",
+		"b.zip/",
+		"b.zip/x.txt=x",
+		"b.zip/sub/",
+		"b.zip/sub/y.txt=y",
+		"b.zip/deep/",
+		"b.zip/deep/er/",
+		"b.zip/deep/er/z.txt=z",
+		"c.tar.gz/",
+		"c.tar.gz/dir/",
+		"c.tar.gz/dir/m1.txt=m1",
+		"c.tar.gz/m2.txt=m2",
+		"d.TAR/",
+		"d.TAR/n.txt=n",
+		"d.TAR/empty.txt=",
+	}
+	if !reflect.DeepEqual(walked, want) {
+		t.Errorf("walked\n%q\nwant\n%q", walked, want)
+	}
+}
+
+func TestWalkSourcesRejectsMembersOutside(t *testing.T) {
+	tests := []struct {
+		archive string
+		member  string
+	}{
+		{"a.zip", "../evil.txt"},
+		{"a.zip", "sub/../../evil.txt"},
+		{"a.tar", "/etc/evil.txt"},
+		{"a.tar", "../evil.txt"},
+	}
+
+	for _, tt := range tests {
+		srcDir := t.TempDir()
+		archivePath := filepath.Join(srcDir, tt.archive)
+		members := []testMember{{tt.member, "evil"}}
+		if strings.HasSuffix(tt.archive, ".zip") {
+			writeZip(t, archivePath, members)
+		} else {
+			writeTar(t, archivePath, members)
+		}
+		if _, err := walkedSources(t, srcDir); err == nil {
+			t.Errorf("%s member %q: walkSources succeeded, want an error", tt.archive, tt.member)
+		}
+	}
+}
+
+func TestTarArchiveOpen(t *testing.T) {
+	archivePath := filepath.Join(t.TempDir(), "a.tar.gz")
+	var members []testMember
+	for _, name := range []string{"0", "1", "2", "3", "4", "5"} {
+		members = append(members, testMember{name + ".txt", strings.Repeat(name, 1000)})
+	}
+	writeTar(t, archivePath, members)
+	archive := &tarArchive{path: archivePath, last: len(members) - 1}
+
+	read := func(index int) {
+		t.Helper()
+		rc, err := archive.open(index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != members[index].body {
+			t.Errorf("member %d holds %.10q..., want %.10q...", index, body, members[index].body)
+		}
+		if err := rc.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// In order, out of order, the same member twice and past the end.
+	for _, index := range []int{0, 1, 4, 2, 2, 5, 3} {
+		read(index)
+	}
+	if _, err := archive.open(len(members)); err == nil {
+		t.Error("opening a member past the end succeeded")
+	}
+
+	// Two members open at once, the walk ending in between.
+	first, err := archive.open(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := archive.open(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive.walked()
+	first.Close()
+	if len(archive.idle) == 0 {
+		t.Error("cursors were closed while a member is still open")
+	}
+	second.Close()
+	if len(archive.idle) != 0 || archive.members != 0 {
+		t.Errorf("%d cursors kept and %d members open once the walk is over, want none", len(archive.idle), archive.members)
+	}
+}
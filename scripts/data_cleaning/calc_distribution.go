@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Global map to aggregate distributions for each character
+var globalCharDistributions = make(map[rune][]float64)
+
+// aggregateCharacterDistributions updates the global distribution map for each character.
+// Shares are fractions between 0 and 1, as compared by extract-prefixes.
+func aggregateCharacterDistributions(distributions map[rune]int, total int) {
+	for char, count := range distributions {
+		share := float64(count) / float64(total)
+		globalCharDistributions[char] = append(globalCharDistributions[char], share)
+	}
+}
+
+// distributionPercentiles selects the percentiles written for each character.
+type distributionPercentiles struct {
+	// lower and upper become MinRange and MaxRange.
+	lower, upper float64
+	// extra are also written to the Percentiles map of each character.
+	extra []float64
+}
+
+// calculateCharacterStats computes the statistics of each character's share of the following characters.
+func calculateCharacterStats(percentiles distributionPercentiles) map[rune]CharacterStats {
+	result := make(map[rune]CharacterStats)
+
+	for char, shares := range globalCharDistributions {
+		sort.Float64s(shares)
+		average := calculateAverage(shares)
+		stats := CharacterStats{
+			Average:     average,
+			MinRange:    calculatePercentile(shares, percentiles.lower),
+			MaxRange:    calculatePercentile(shares, percentiles.upper),
+			Median:      calculateMedian(shares),
+			StdDev:      calculateStdDev(shares, average),
+			Samples:     len(shares),
+			Percentiles: make(map[string]float64),
+		}
+		for _, p := range percentiles.extra {
+			stats.Percentiles[percentileKey(p)] = calculatePercentile(shares, p)
+		}
+		result[char] = stats
+	}
+
+	return result
+}
+
+// percentileKey names a percentile in the Percentiles map, e.g. "p5" or "p99.5".
+func percentileKey(p float64) string {
+	return "p" + strconv.FormatFloat(p, 'f', -1, 64)
+}
+
+// Helper function to calculate the average of a slice.
+func calculateAverage(data []float64) float64 {
+	sum := 0.0
+	for _, value := range data {
+		sum += value
+	}
+	return sum / float64(len(data))
+}
+
+// calculateMedian returns the median of a sorted slice.
+func calculateMedian(data []float64) float64 {
+	mid := len(data) / 2
+	if len(data)%2 == 0 {
+		return (data[mid-1] + data[mid]) / 2
+	}
+	return data[mid]
+}
+
+// calculateStdDev returns the population standard deviation of a slice with the given average.
+func calculateStdDev(data []float64, average float64) float64 {
+	sum := 0.0
+	for _, value := range data {
+		sum += (value - average) * (value - average)
+	}
+	return math.Sqrt(sum / float64(len(data)))
+}
+
+// Helper function to calculate a specific percentile from a sorted slice.
+// It takes the element at rank floor(percentile% of the count), without interpolating.
+func calculatePercentile(data []float64, percentile float64) float64 {
+	index := int(percentile * float64(len(data)) / 100)
+	if index >= len(data) {
+		index = len(data) - 1
+	}
+	return data[index]
+}
+
+// ScanForCharacterDistributions processes password files and computes global character distributions.
+func ScanForCharacterDistributions(srcDir, encoding string, outputFile string, occurrenceThreshold int, percentiles distributionPercentiles) error {
+	err := filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			log.Printf("Error accessing file %s: %v", path, err)
+			return nil
+		}
+		if strings.HasSuffix(trimCompressionExt(info.Name()), "_passwords.txt") {
+			fmt.Printf("Processing file: %s\n", info.Name())
+
+			// Reset the Trie for each file.
+			passTrie := NewTrie()
+
+			// Load passwords into the Trie.
+			LoadCredentialsFromFile(path, encoding, passTrie)
+
+			// Get prefixes with high standalone occurrences.
+			highStandalone := collectHighStandalone(passTrie, occurrenceThreshold)
+
+			// Aggregate character distributions across all prefixes.
+			for _, prefix := range highStandalone {
+				followingCharCount := collectFollowingChars(passTrie, prefix)
+
+				// Calculate total following characters for the prefix.
+				totalFollowingCount := 0
+				for _, count := range followingCharCount {
+					totalFollowingCount += count
+				}
+
+				if totalFollowingCount > 0 {
+					aggregateCharacterDistributions(followingCharCount, totalFollowingCount)
+				}
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("error walking through directory: %v", err)
+	}
+
+	// Write the final statistics to the output file.
+	return writeFinalStatistics(outputFile, percentiles)
+}
+
+// writeFinalStatistics writes the statistics as the JSON object LoadCharacterStats
+// reads, keyed by the character itself.
+func writeFinalStatistics(outputFile string, percentiles distributionPercentiles) error {
+	stats := make(map[string]CharacterStats)
+	for char, stat := range calculateCharacterStats(percentiles) {
+		stats[string(char)] = stat
+	}
+
+	file, err := os.Create(outputFile)
+	if err != nil {
+		return fmt.Errorf("error creating output file: %v", err)
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "    ")
+	if err := encoder.Encode(stats); err != nil {
+		return fmt.Errorf("error encoding JSON: %v", err)
+	}
+	fmt.Printf("Character distributions logged to %s\n", outputFile)
+	return nil
+}
+
+// cmdDistribution implements the distribution subcommand.
+func cmdDistribution(args []string) error {
+	fs := flag.NewFlagSet("distribution", flag.ExitOnError)
+	configFile := configFlag(fs)
+	srcDir := fs.String("src", "../OrganizedPasswords", "directory containing *_passwords.txt files")
+	outputFile := fs.String("out", "char_distributions.json", "file to write the character distribution statistics to")
+	occurrenceThreshold := fs.Int("threshold", 0, "minimum standalone occurrences for a prefix to be used (overrides the config)")
+	fs.Parse(args)
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	if !flagWasSet(fs, "threshold") {
+		*occurrenceThreshold = cfg.Analysis.DistributionThreshold
+	}
+
+	// Process files and compute distributions
+	percentiles := distributionPercentiles{
+		lower: cfg.Analysis.LowerPercentile,
+		upper: cfg.Analysis.UpperPercentile,
+		extra: cfg.Analysis.Percentiles,
+	}
+	return ScanForCharacterDistributions(*srcDir, cfg.Input.Encoding, *outputFile, *occurrenceThreshold, percentiles)
+}
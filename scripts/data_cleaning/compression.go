@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+)
+
+// Input compressions; compressionNone is a plain file.
+const (
+	compressionNone  = "none"
+	compressionGzip  = "gzip"
+	compressionBzip2 = "bzip2"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// bzip2HeaderLength is the length of the bzip2 stream header and the magic of
+// its first block.
+const bzip2HeaderLength = 10
+
+// bzip2BlockMagic starts the first block of a non-empty bzip2 stream.
+var bzip2BlockMagic = []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}
+
+// isBzip2Header reports whether head starts with a bzip2 stream header: "BZh",
+// a block size digit from 1 to 9 and the magic of the first block. Text such
+// as "BZhukov@mail.ru:..." starts with "BZh" as well, so the three letters
+// alone are not enough.
+func isBzip2Header(head []byte) bool {
+	return len(head) >= bzip2HeaderLength &&
+		bytes.HasPrefix(head, []byte("BZh")) &&
+		head[3] >= '1' && head[3] <= '9' &&
+		bytes.Equal(head[4:bzip2HeaderLength], bzip2BlockMagic)
+}
+
+// compressionExts maps the extensions of compressed files to their compression.
+var compressionExts = map[string]string{
+	".gz":  compressionGzip,
+	".bz2": compressionBzip2,
+}
+
+// detectCompression returns the compression of a file from its first bytes
+// or, when they are not recognised, from the extension of its name. An empty
+// bzip2 stream has no block, so it is only recognised by its extension.
+func detectCompression(name string, head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		return compressionGzip
+	case isBzip2Header(head):
+		return compressionBzip2
+	}
+	for ext, compression := range compressionExts {
+		if strings.HasSuffix(name, ext) {
+			return compression
+		}
+	}
+	return compressionNone
+}
+
+// trimCompressionExt returns a file name without its .gz or .bz2 extension.
+func trimCompressionExt(name string) string {
+	for ext := range compressionExts {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+	return name
+}
+
+// openDecompressed returns a reader of the contents of the file r, named
+// name, decompressing gzip and bzip2 files, and the compression it detected.
+// Closing the file is left to the caller.
+func openDecompressed(r io.Reader, name string) (io.Reader, string, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(bzip2HeaderLength)
+	if err != nil && err != io.EOF {
+		return nil, "", err
+	}
+	compression := detectCompression(name, head)
+	switch compression {
+	case compressionGzip:
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, "", err
+		}
+		return gz, compression, nil
+	case compressionBzip2:
+		return bzip2.NewReader(br), compression, nil
+	}
+	return br, compression, nil
+}
+
+// compressedName returns the name of an output file: name itself, or with a
+// .gz extension when the output is compressed.
+func compressedName(name string, compress bool) string {
+	if compress {
+		return name + ".gz"
+	}
+	return name
+}
+
+// outputFile is a buffered output file that is gzip-compressed when created
+// with compress set. Appending to a compressed file adds a gzip member, which
+// gzip readers read as one stream with the members before it.
+type outputFile struct {
+	*bufio.Writer
+	file *os.File
+	gz   *gzip.Writer
+}
+
+// createOutput creates, or with appendTo appends to, the file at path.
+func createOutput(path string, compress, appendTo bool) (*outputFile, error) {
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if appendTo {
+		flag = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	file, err := os.OpenFile(path, flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+	out := &outputFile{file: file}
+	if compress {
+		out.gz = gzip.NewWriter(file)
+		out.Writer = bufio.NewWriter(out.gz)
+	} else {
+		out.Writer = bufio.NewWriter(file)
+	}
+	return out, nil
+}
+
+// Close flushes the buffer and the gzip stream and closes the file.
+func (o *outputFile) Close() error {
+	err := o.Flush()
+	if o.gz != nil {
+		if gzErr := o.gz.Close(); err == nil {
+			err = gzErr
+		}
+	}
+	if closeErr := o.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
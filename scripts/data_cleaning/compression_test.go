@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// bzip2Credential is "bob@a.com:secret\n" compressed by bzip2 -9.
+var bzip2Credential = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0x40, 0xe4,
+	0x47, 0xca, 0x00, 0x00, 0x03, 0x5d, 0x80, 0x00, 0x10, 0x00, 0x01, 0x00,
+	0x10, 0x40, 0x00, 0x3a, 0x02, 0x9c, 0x00, 0x20, 0x00, 0x22, 0x10, 0x66,
+	0x84, 0xfd, 0x50, 0x80, 0x68, 0x00, 0x8b, 0x4b, 0x25, 0x60, 0x42, 0x18,
+	0x9f, 0x8b, 0xb9, 0x22, 0x9c, 0x28, 0x48, 0x20, 0x72, 0x23, 0xe5, 0x00,
+}
+
+// bzip2Empty is an empty bzip2 stream, which has no block.
+var bzip2Empty = []byte{0x42, 0x5a, 0x68, 0x39, 0x17, 0x72, 0x45, 0x38, 0x50, 0x90, 0x00, 0x00, 0x00, 0x00}
+
+func gzipBytes(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := io.WriteString(gw, s); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestOpenDecompressed(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        []byte
+		compression string
+		want        string
+	}{
+		{"a.txt", []byte("bob@a.com:secret\n"), compressionNone, "bob@a.com:secret\n"},
+		{"a.txt", []byte("a:b\n"), compressionNone, "a:b\n"},
+		{"a.txt", nil, compressionNone, ""},
+		{"a.gz", gzipBytes(t, "bob@a.com:secret\n"), compressionGzip, "bob@a.com:secret\n"},
+		{"a.txt", gzipBytes(t, "bob@a.com:secret\n"), compressionGzip, "bob@a.com:secret\n"},
+		{"a.bz2", bzip2Credential, compressionBzip2, "bob@a.com:secret\n"},
+		{"a", bzip2Credential, compressionBzip2, "bob@a.com:secret\n"},
+		{"a.bz2", bzip2Empty, compressionBzip2, ""},
+		// Text starting like a bzip2 header is read as it is.
+		{"b.txt", []byte("BZhukov@mail.ru:secret\n"), compressionNone, "BZhukov@mail.ru:secret\n"},
+		{"b.txt", []byte("BZh9@mail.ru:secret\n"), compressionNone, "BZh9@mail.ru:secret\n"},
+		{"b.txt", []byte("BZh9"), compressionNone, "BZh9"},
+	}
+
+	for _, tt := range tests {
+		r, compression, err := openDecompressed(bytes.NewReader(tt.data), tt.name)
+		if err != nil {
+			t.Errorf("%s %.12q: %v", tt.name, tt.data, err)
+			continue
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Errorf("%s %.12q: reading: %v", tt.name, tt.data, err)
+			continue
+		}
+		if compression != tt.compression || string(got) != tt.want {
+			t.Errorf("%s %.12q: read %q as %s, want %q as %s", tt.name, tt.data, got, compression, tt.want, tt.compression)
+		}
+	}
+
+	// A file named .gz that is not gzip compressed cannot be read.
+	if _, _, err := openDecompressed(strings.NewReader("bob@a.com:secret\n"), "a.gz"); err == nil {
+		t.Error("opening plain text named a.gz succeeded")
+	}
+}
+
+func TestCreateOutputAppendsGzipMembers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.txt.gz")
+	for i, line := range []string{"first\n", "second\n"} {
+		out, err := createOutput(path, true, i > 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := out.WriteString(line); err != nil {
+			t.Fatal(err)
+		}
+		if err := out.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lines, err := openLineReader(path, encodingAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lines.Close()
+	var got []string
+	for lines.Scan() {
+		got = append(got, lines.Text())
+	}
+	if err := lines.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, ",") != "first,second" {
+		t.Errorf("read %q, want both appended lines", got)
+	}
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Config describes a complete cleaning run: which filters run, in what order,
+// and every threshold they use. It is loaded from a JSON file so that a run is
+// fully described by one versioned file.
+type Config struct {
+	Filters         []string              `json:"filters"`
+	PriorWork       PriorWorkConfig       `json:"prior_work"`
+	RuleBased       RuleBasedConfig       `json:"rule_based"`
+	SuspiciousEmail SuspiciousEmailConfig `json:"suspicious_email"`
+	FOD             FODConfig             `json:"fod"`
+	FOR             FORConfig             `json:"for"`
+	Analysis        AnalysisConfig        `json:"analysis"`
+	Input           InputConfig           `json:"input"`
+	Output          OutputConfig          `json:"output"`
+	Engine          EngineConfig          `json:"engine"`
+}
+
+// PriorWorkConfig holds the password checks used by prior work.
+type PriorWorkConfig struct {
+	MinPasswordLength int `json:"min_password_length"`
+	MaxPasswordLength int `json:"max_password_length"`
+	// HexLength is the length from which an all hexadecimal password is treated as a hash.
+	HexLength int `json:"hex_length"`
+	// NonASCII is what happens to credentials with characters outside ASCII:
+	// "drop" removes them, "keep" keeps them, and "separate" keeps them in a
+	// separate output tree.
+	NonASCII string `json:"non_ascii"`
+}
+
+// RuleBasedConfig holds the email rules.
+type RuleBasedConfig struct {
+	MinEmailLength int `json:"min_email_length"`
+	MaxEmailLength int `json:"max_email_length"`
+	// MaxPerEmail is how many credentials a single email may have before the rest are removed.
+	MaxPerEmail int `json:"max_per_email"`
+	// SequenceLength is how many distinct numbers a run of usernames such as
+	// user1@x.com, user2@x.com, ... needs before the whole run is removed.
+	SequenceLength int `json:"sequence_length"`
+	// SequenceMaxGap is the largest step between consecutive numbers of a run.
+	SequenceMaxGap int `json:"sequence_max_gap"`
+	// Scope is "file" to apply the rules within each file, or "dataset" to
+	// apply them across every file of the run.
+	Scope string `json:"scope"`
+	// CanonicalEmails compares emails in their canonical form (see
+	// canonicalEmail) when looking for duplicates, emails over the limit and
+	// sequential usernames.
+	CanonicalEmails bool `json:"canonical_emails"`
+	// TLDFile is a list of the top-level domains email addresses may end in,
+	// in the format of the IANA list. The list built into the binary, from
+	// tlds.txt, is used when it is empty.
+	TLDFile string `json:"tld_file"`
+}
+
+// SuspiciousEmailConfig holds the domain sequences generated accounts are spread across.
+type SuspiciousEmailConfig struct {
+	Sequences [][]string `json:"sequences"`
+	// MinDomains is how many domains, in sorted order, a run of one local part
+	// and one password needs before learn-sequences counts it.
+	MinDomains int `json:"min_domains"`
+	// MinSupport is how many runs a domain sequence needs before
+	// learn-sequences reports it.
+	MinSupport int `json:"min_support"`
+	// LearnedFile is the list of domain sequences written by learn-sequences.
+	LearnedFile string `json:"learned_file"`
+	// RemoveLearned makes the filter remove the sequences of LearnedFile as
+	// well as Sequences.
+	RemoveLearned bool `json:"remove_learned"`
+	// Grouping is how credentials are put together before their domains are
+	// compared with the sequences: "contiguous" takes runs of consecutive
+	// lines with the same local part, as the generators wrote them, and
+	// "local_part" collects every line with the same local part and password,
+	// wherever it is, so the input order does not matter.
+	Grouping string `json:"grouping"`
+	// Scope is "file" to group within each file, or "dataset" to group across
+	// every file of the run; dataset scope needs the "local_part" grouping.
+	Scope string `json:"scope"`
+}
+
+// FODConfig holds the passwords found by manual review of the follow-on distribution.
+type FODConfig struct {
+	// ListFile is the reviewed filter list read by the fod filter (see fodList).
+	ListFile string `json:"list_file"`
+}
+
+// FORConfig holds the follow-on ratio settings.
+type FORConfig struct {
+	// PasswordsFile is the list written by identify-for and read by the for filter.
+	PasswordsFile string `json:"passwords_file"`
+	// Curve is the piecewise threshold identify-for compares following counts against.
+	Curve []CurveSegment `json:"curve"`
+}
+
+// CurveSegment gives the follow-on threshold for standalone counts in [Min, Max].
+// The threshold is standalone/Divisor + Offset, or just Offset when Divisor is 0.
+// A Max of 0 means the segment has no upper bound.
+type CurveSegment struct {
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+	Divisor float64 `json:"divisor"`
+	Offset  float64 `json:"offset"`
+}
+
+// AnalysisConfig holds the thresholds of the analysis subcommands.
+type AnalysisConfig struct {
+	DistributionThreshold int `json:"distribution_threshold"`
+	PrefixThreshold       int `json:"prefix_threshold"`
+	// MinOutlierShare is the smallest share of following characters an outlier must have to be logged.
+	MinOutlierShare     float64 `json:"min_outlier_share"`
+	RatioStatsThreshold int     `json:"ratio_stats_threshold"`
+	// LowerPercentile and UpperPercentile give the MinRange and MaxRange of
+	// each character in char_distributions.json.
+	LowerPercentile float64 `json:"lower_percentile"`
+	UpperPercentile float64 `json:"upper_percentile"`
+	// Percentiles are also written to char_distributions.json for reference.
+	Percentiles []float64 `json:"percentiles"`
+}
+
+// InputConfig describes how breach files are read.
+type InputConfig struct {
+	// Encoding is "auto" to detect the encoding of every file, or one of
+	// "utf-8", "latin-1", "windows-1251", "utf-16le" and "utf-16be".
+	Encoding string `json:"encoding"`
+}
+
+// OutputConfig describes how cleaned data and removal logs are written.
+type OutputConfig struct {
+	// Gzip compresses the cleaned files and the removal logs and adds .gz to their names.
+	Gzip bool `json:"gzip"`
+}
+
+// EngineConfig holds the resources the cleaner may use.
+type EngineConfig struct {
+	// TempDir is where stateful filters spill to disk; empty means the system temp directory.
+	TempDir string `json:"temp_dir"`
+	// SortMemoryMB bounds the memory a single external sort buffers before spilling.
+	SortMemoryMB int `json:"sort_memory_mb"`
+	// Workers is how many files are cleaned in parallel. Each worker may use
+	// several times SortMemoryMB.
+	Workers int `json:"workers"`
+}
+
+// defaultConfig returns the settings the pipeline used before it was
+// configurable, except that rule_based compares emails in canonical form and
+// lets the numbers of sequential usernames skip by up to two.
+func defaultConfig() *Config {
+	return &Config{
+		Filters: []string{"prior_work", "rule_based", "suspicious_email", "fod", "for", "FBOB"},
+		PriorWork: PriorWorkConfig{
+			MinPasswordLength: 4,
+			MaxPasswordLength: 30,
+			HexLength:         20,
+			NonASCII:          "drop",
+		},
+		RuleBased: RuleBasedConfig{
+			MinEmailLength:  10,
+			MaxEmailLength:  40,
+			MaxPerEmail:     100,
+			SequenceLength:  100,
+			SequenceMaxGap:  2,
+			Scope:           "file",
+			CanonicalEmails: true,
+		},
+		SuspiciousEmail: SuspiciousEmailConfig{
+			Sequences: [][]string{
+				{"@epost.de", "@gmx.de", "@lycos.de", "@web.de", "@yahoo.de"},
+				{"@inbox.ru", "@list.ru", "@mail.ru", "@rambler.ru", "@yandex.ru"},
+				{"@bk.ru", "@gmail.com", "@gmx.com", "@inbox.ru", "@list.ru", "@mail.ru"},
+			},
+			MinDomains:  4,
+			MinSupport:  10,
+			LearnedFile: "suspicious_sequences_learned.json",
+			Grouping:    "contiguous",
+			Scope:       "file",
+		},
+		FOD: FODConfig{
+			ListFile: "fod_filter_list.json",
+		},
+		FOR: FORConfig{
+			PasswordsFile: "for_passwords_identified.json",
+			Curve: []CurveSegment{
+				{Min: 3000, Max: 5000, Offset: 1},
+				{Min: 5000, Max: 20000, Divisor: 500, Offset: -10},
+				{Min: 20000, Divisor: 120, Offset: -135},
+			},
+		},
+		Analysis: AnalysisConfig{
+			DistributionThreshold: 50000,
+			PrefixThreshold:       1000,
+			MinOutlierShare:       0.005,
+			RatioStatsThreshold:   1000,
+			LowerPercentile:       5,
+			UpperPercentile:       95,
+			Percentiles:           []float64{1, 5, 25, 50, 75, 95, 99},
+		},
+		Input: InputConfig{
+			Encoding: encodingAuto,
+		},
+		Engine: EngineConfig{
+			SortMemoryMB: 256,
+			Workers:      1,
+		},
+	}
+}
+
+// loadConfig reads a config file on top of the defaults and validates it.
+// An empty path returns the defaults.
+func loadConfig(path string) (*Config, error) {
+	cfg := defaultConfig()
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		decoder := json.NewDecoder(file)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(cfg); err != nil {
+			return nil, fmt.Errorf("error decoding config %s: %v", path, err)
+		}
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %v", err)
+	}
+	return cfg, nil
+}
+
+// validate reports the first setting that cannot produce a sensible run.
+func (cfg *Config) validate() error {
+	if len(cfg.Filters) == 0 {
+		return fmt.Errorf("filters: at least one filter is required")
+	}
+	listed := make(map[string]bool)
+	for _, name := range cfg.Filters {
+		if _, exists := filterRegistry[name]; !exists {
+			return fmt.Errorf("filters: unknown filter %q", name)
+		}
+		// Dataset verdicts and removal logs are kept by filter name.
+		if listed[name] {
+			return fmt.Errorf("filters: %q is listed more than once", name)
+		}
+		listed[name] = true
+	}
+
+	pw := cfg.PriorWork
+	if pw.MinPasswordLength < 0 || pw.MaxPasswordLength < pw.MinPasswordLength {
+		return fmt.Errorf("prior_work: password length range [%d, %d] is empty", pw.MinPasswordLength, pw.MaxPasswordLength)
+	}
+	if pw.HexLength <= 0 {
+		return fmt.Errorf("prior_work: hex_length must be positive")
+	}
+	if pw.NonASCII != "drop" && pw.NonASCII != "keep" && pw.NonASCII != "separate" {
+		return fmt.Errorf("prior_work: non_ascii must be \"drop\", \"keep\" or \"separate\", not %q", pw.NonASCII)
+	}
+
+	rb := cfg.RuleBased
+	if rb.MinEmailLength < 0 || rb.MaxEmailLength < rb.MinEmailLength {
+		return fmt.Errorf("rule_based: email length range [%d, %d] is empty", rb.MinEmailLength, rb.MaxEmailLength)
+	}
+	if rb.MaxPerEmail <= 0 {
+		return fmt.Errorf("rule_based: max_per_email must be positive")
+	}
+	if rb.SequenceLength <= 1 {
+		return fmt.Errorf("rule_based: sequence_length must be at least 2")
+	}
+	if rb.SequenceMaxGap < 1 {
+		return fmt.Errorf("rule_based: sequence_max_gap must be at least 1")
+	}
+	if rb.Scope != "file" && rb.Scope != "dataset" {
+		return fmt.Errorf("rule_based: scope must be \"file\" or \"dataset\", not %q", rb.Scope)
+	}
+
+	for i, seq := range cfg.SuspiciousEmail.Sequences {
+		if len(seq) < 2 {
+			return fmt.Errorf("suspicious_email: sequence %d needs at least two domains", i)
+		}
+		for _, domain := range seq {
+			if !strings.HasPrefix(domain, "@") || len(domain) < 2 {
+				return fmt.Errorf("suspicious_email: sequence %d: domain %q must start with @", i, domain)
+			}
+		}
+	}
+	se := cfg.SuspiciousEmail
+	if se.MinDomains < 2 {
+		return fmt.Errorf("suspicious_email: min_domains must be at least 2")
+	}
+	if se.MinSupport < 1 {
+		return fmt.Errorf("suspicious_email: min_support must be at least 1")
+	}
+	if se.RemoveLearned && se.LearnedFile == "" {
+		return fmt.Errorf("suspicious_email: remove_learned needs a learned_file")
+	}
+	if se.Grouping != "contiguous" && se.Grouping != "local_part" {
+		return fmt.Errorf("suspicious_email: grouping must be \"contiguous\" or \"local_part\", not %q", se.Grouping)
+	}
+	if se.Scope != "file" && se.Scope != "dataset" {
+		return fmt.Errorf("suspicious_email: scope must be \"file\" or \"dataset\", not %q", se.Scope)
+	}
+	if se.Scope == "dataset" && se.Grouping != "local_part" {
+		return fmt.Errorf("suspicious_email: dataset scope needs the \"local_part\" grouping")
+	}
+
+	if cfg.enabled("fod") && cfg.FOD.ListFile == "" {
+		return fmt.Errorf("fod: list_file is required")
+	}
+
+	if cfg.enabled("for") && cfg.FOR.PasswordsFile == "" {
+		return fmt.Errorf("for: passwords_file is required")
+	}
+	for i, seg := range cfg.FOR.Curve {
+		if seg.Min < 0 || (seg.Max != 0 && seg.Max < seg.Min) || seg.Divisor < 0 {
+			return fmt.Errorf("for: curve segment %d is invalid", i)
+		}
+	}
+
+	a := cfg.Analysis
+	if a.DistributionThreshold < 0 || a.PrefixThreshold < 0 || a.RatioStatsThreshold < 0 {
+		return fmt.Errorf("analysis: thresholds must not be negative")
+	}
+	if a.MinOutlierShare < 0 || a.MinOutlierShare > 1 {
+		return fmt.Errorf("analysis: min_outlier_share must be between 0 and 1")
+	}
+	if a.LowerPercentile < 0 || a.UpperPercentile > 100 || a.UpperPercentile < a.LowerPercentile {
+		return fmt.Errorf("analysis: percentile range [%g, %g] must lie within [0, 100]", a.LowerPercentile, a.UpperPercentile)
+	}
+	for _, p := range a.Percentiles {
+		if p < 0 || p > 100 {
+			return fmt.Errorf("analysis: percentile %g must be between 0 and 100", p)
+		}
+	}
+
+	knownEncoding := false
+	for _, encoding := range inputEncodings {
+		knownEncoding = knownEncoding || cfg.Input.Encoding == encoding
+	}
+	if !knownEncoding {
+		return fmt.Errorf("input: unknown encoding %q, expected one of %s", cfg.Input.Encoding, strings.Join(inputEncodings, ", "))
+	}
+
+	if cfg.Engine.SortMemoryMB <= 0 {
+		return fmt.Errorf("engine: sort_memory_mb must be positive")
+	}
+	if cfg.Engine.Workers <= 0 {
+		return fmt.Errorf("engine: workers must be positive")
+	}
+	return nil
+}
+
+// enabled reports whether the named filter is in the pipeline. The files a
+// filter reads are only required when it runs.
+func (cfg *Config) enabled(name string) bool {
+	for _, filter := range cfg.Filters {
+		if filter == name {
+			return true
+		}
+	}
+	return false
+}
+
+// threshold returns the follow-on threshold for a standalone count, and false
+// if no curve segment covers it.
+func (f FORConfig) threshold(standalone float64) (float64, bool) {
+	for _, seg := range f.Curve {
+		if standalone < seg.Min || (seg.Max != 0 && standalone > seg.Max) {
+			continue
+		}
+		if seg.Divisor == 0 {
+			return seg.Offset, true
+		}
+		return standalone/seg.Divisor + seg.Offset, true
+	}
+	return 0, false
+}
+
+// configFlag registers the -config flag on a subcommand.
+func configFlag(fs *flag.FlagSet) *string {
+	return fs.String("config", "", "pipeline config file (built-in defaults when empty)")
+}
+
+// flagWasSet reports whether a flag was given on the command line, so that it
+// can override the value from the config file.
+func flagWasSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+)
+
+// credentialSeparators are the separators found between identifier and
+// password in the 4iQ dumps: colon, semicolon and tab.
+const credentialSeparators = ":;\t"
+
+// Reasons parseCredentialLine gives for a line it cannot parse.
+const (
+	parseNoSeparator       = "no_separator"
+	parseEmptyIdentifier   = "empty_identifier"
+	parseInvalidIdentifier = "invalid_identifier"
+)
+
+// parseCredentialLine splits a breach line into identifier and password.
+//
+// The identifier ends at the first separator of any kind, which cannot occur
+// in an email address, and everything after it is the password, separators
+// included: "a@b.com:pa:ss" has the password "pa:ss" and "a@b.com;pa:ss" has
+// "pa:ss". The password has surrounding whitespace trimmed, as it always had.
+//
+// Lines that do not hold a credential, because they have no separator or the
+// identifier is empty or contains whitespace, return false and the reason.
+func parseCredentialLine(line string) (username, password, reason string, ok bool) {
+	sep := strings.IndexAny(line, credentialSeparators)
+	switch {
+	case sep < 0:
+		return "", "", parseNoSeparator, false
+	case sep == 0:
+		return "", "", parseEmptyIdentifier, false
+	case strings.ContainsAny(line[:sep], " \r\n\v\f"):
+		return "", "", parseInvalidIdentifier, false
+	}
+	return line[:sep], strings.TrimSpace(line[sep+1:]), "", true
+}
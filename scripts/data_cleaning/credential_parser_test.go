@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestParseCredentialLine(t *testing.T) {
+	tests := []struct {
+		line     string
+		username string
+		password string
+		reason   string
+	}{
+		{"bob@a.com:secret", "bob@a.com", "secret", ""},
+		{"bob@a.com;secret", "bob@a.com", "secret", ""},
+		{"bob@a.com\tsecret", "bob@a.com", "secret", ""},
+		{"bob@a.com:pa:ss", "bob@a.com", "pa:ss", ""},
+		{"bob@a.com;pa:ss", "bob@a.com", "pa:ss", ""},
+		{"bob@a.com:pa;ss\tx", "bob@a.com", "pa;ss\tx", ""},
+		{"bob@a.com: secret \r", "bob@a.com", "secret", ""},
+		{"bob@a.com:", "bob@a.com", "", ""},
+		{"bob:secret", "bob", "secret", ""},
+		{"bob@a.com", "", "", parseNoSeparator},
+		{"", "", "", parseNoSeparator},
+		{":secret", "", "", parseEmptyIdentifier},
+		{";secret", "", "", parseEmptyIdentifier},
+		{"bob @a.com:secret", "", "", parseInvalidIdentifier},
+		{"bob@a.com\r:secret", "", "", parseInvalidIdentifier},
+	}
+
+	for _, tt := range tests {
+		username, password, reason, ok := parseCredentialLine(tt.line)
+		if username != tt.username || password != tt.password || reason != tt.reason || ok != (tt.reason == "") {
+			t.Errorf("parseCredentialLine(%q) = %q, %q, %q, %v, want %q, %q, %q, %v",
+				tt.line, username, password, reason, ok, tt.username, tt.password, tt.reason, tt.reason == "")
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// checkpointFile is the manifest of a clean run, kept next to the removal logs.
+const checkpointFile = "clean_checkpoint.jsonl"
+
+// checkpointHeader is the first line of the manifest.
+type checkpointHeader struct {
+	// RunID identifies the run in the removal log; a resumed run keeps it.
+	RunID string `json:"run_id"`
+	// Config is the hash of the settings the run was started with.
+	Config string `json:"config"`
+	// Logs holds the size of each removal log before the run started.
+	Logs map[string]int64 `json:"logs"`
+}
+
+// checkpointEntry is written after each file whose output and logs are complete.
+type checkpointEntry struct {
+	// File is the path of the input file relative to the source directory.
+	File   string      `json:"file"`
+	SHA256 string      `json:"sha256"`
+	Stats  statsReport `json:"stats"`
+	// Logs holds the size of each removal log once the file was committed.
+	Logs map[string]int64 `json:"logs"`
+}
+
+// checkpointFooter is the last line of the manifest of a run that finished.
+type checkpointFooter struct {
+	Completed time.Time `json:"completed"`
+}
+
+// checkpoint records the files a clean run has completed, so that an
+// interrupted run can resume after the last of them. Logs are appended before
+// a file is recorded, so on resume anything past the recorded log sizes
+// belongs to a file that did not finish and is cut off.
+type checkpoint struct {
+	runID  string
+	file   *os.File
+	logDir string
+	logs   []string
+	// done maps the relative path of every completed file to its entry.
+	done map[string]checkpointEntry
+}
+
+// openCheckpoint starts the manifest of run runID in logDir, or continues it
+// if resume is set, taking over the run ID of the earlier run. The manifest
+// of a run that finished is replaced. logs are the names of the removal logs
+// the run writes.
+func openCheckpoint(logDir, runID, config string, logs []string, resume bool) (*checkpoint, error) {
+	path := filepath.Join(logDir, checkpointFile)
+	cp := &checkpoint{runID: runID, logDir: logDir, logs: logs, done: make(map[string]checkpointEntry)}
+
+	_, err := os.Stat(path)
+	exists := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if exists {
+		finished, err := manifestFinished(path)
+		if err != nil {
+			return nil, err
+		}
+		exists = !finished
+	}
+	if exists && !resume {
+		return nil, fmt.Errorf("%s is left from an interrupted run; pass -resume to continue it, or remove it and the removal logs to start over", path)
+	}
+	if !exists {
+		if err := os.MkdirAll(logDir, os.ModePerm); err != nil {
+			return nil, err
+		}
+		if cp.file, err = os.Create(path); err != nil {
+			return nil, err
+		}
+		sizes, err := cp.logSizes()
+		if err == nil {
+			err = cp.writeLine(checkpointHeader{RunID: runID, Config: config, Logs: sizes})
+		}
+		if err != nil {
+			cp.file.Close()
+			return nil, err
+		}
+		return cp, nil
+	}
+
+	if cp.file, err = os.OpenFile(path, os.O_RDWR, 0644); err != nil {
+		return nil, err
+	}
+	if err := cp.load(config); err != nil {
+		cp.file.Close()
+		return nil, fmt.Errorf("cannot resume from %s: %v", path, err)
+	}
+	return cp, nil
+}
+
+// load reads the manifest, drops a line left incomplete by an interruption
+// and cuts the removal logs back to the sizes of the last completed file.
+func (cp *checkpoint) load(config string) error {
+	r := bufio.NewReader(cp.file)
+	var offset int64
+	var sizes map[string]int64
+	for lineNo := 1; ; lineNo++ {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// A line without a newline was cut off while being written.
+			break
+		}
+		if err != nil {
+			return err
+		}
+		offset += int64(len(line))
+		if lineNo == 1 {
+			var header checkpointHeader
+			if err := json.Unmarshal(line, &header); err != nil {
+				return fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			if header.Config != config {
+				return fmt.Errorf("the config differs from the one the run was started with")
+			}
+			cp.runID, sizes = header.RunID, header.Logs
+			continue
+		}
+		var entry checkpointEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		cp.done[entry.File] = entry
+		sizes = entry.Logs
+	}
+	if sizes == nil {
+		return fmt.Errorf("the manifest has no header")
+	}
+
+	if err := cp.file.Truncate(offset); err != nil {
+		return err
+	}
+	if _, err := cp.file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	for _, name := range cp.logs {
+		if err := truncateLog(filepath.Join(cp.logDir, name), sizes[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// manifestFinished reports whether the manifest at path ends with the footer
+// written by finish.
+func manifestFinished(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	var last []byte
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return false, err
+		}
+		last = line
+	}
+	var footer checkpointFooter
+	if json.Unmarshal(last, &footer) != nil {
+		return false, nil
+	}
+	return !footer.Completed.IsZero(), nil
+}
+
+// truncateLog cuts a removal log back to size bytes.
+func truncateLog(path string, size int64) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) && size == 0 {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Size() < size {
+		return fmt.Errorf("%s is shorter than the manifest records", path)
+	}
+	return os.Truncate(path, size)
+}
+
+// logSizes returns the current size of each removal log.
+func (cp *checkpoint) logSizes() (map[string]int64, error) {
+	sizes := make(map[string]int64)
+	for _, name := range cp.logs {
+		info, err := os.Stat(filepath.Join(cp.logDir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sizes[name] = info.Size()
+	}
+	return sizes, nil
+}
+
+// record marks a file as completed. It is called once its logs are appended.
+func (cp *checkpoint) record(relPath, hash string, stats CleaningStats) error {
+	sizes, err := cp.logSizes()
+	if err != nil {
+		return err
+	}
+	return cp.writeLine(checkpointEntry{
+		File:   relPath,
+		SHA256: hash,
+		Stats:  stats.report(relPath),
+		Logs:   sizes,
+	})
+}
+
+// finish marks the run as completed, so that the next run starts afresh.
+func (cp *checkpoint) finish() error {
+	return cp.writeLine(checkpointFooter{Completed: time.Now().UTC()})
+}
+
+// writeLine appends v as one JSON line and syncs it to disk.
+func (cp *checkpoint) writeLine(v interface{}) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := cp.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return cp.file.Sync()
+}
+
+func (cp *checkpoint) Close() error {
+	return cp.file.Close()
+}
+
+// newRunID returns an identifier for a run: its start time and a random suffix.
+func newRunID() string {
+	var suffix [4]byte
+	rand.Read(suffix[:])
+	return time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix[:])
+}
+
+// hashFile returns the hex SHA-256 of a file's contents.
+func hashFile(src sourceFile) (string, error) {
+	f, err := src.open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// configHash identifies the settings that decide what a run removes. The
+// engine settings only change how the work is done, so they are left out.
+func configHash(cfg *Config) (string, error) {
+	decisive := *cfg
+	decisive.Engine = EngineConfig{}
+	data, err := json.Marshal(decisive)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// appendLog appends text to a log in dir, creating it if needed.
+func appendLog(t *testing.T, dir, name, text string) {
+	t.Helper()
+	f, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(text); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readLog returns the contents of a log in dir, "" if it does not exist.
+func readLog(t *testing.T, dir, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if os.IsNotExist(err) {
+		return ""
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestCheckpointResumeTruncatesLogs(t *testing.T) {
+	logs := []string{removalsJSONL, removalLogName("fod")}
+	tests := []struct {
+		name string
+		// before is what removals.jsonl holds before the run starts.
+		before string
+		// committed are the removals.jsonl lines of the files recorded in
+		// the manifest before the interruption, one file each.
+		committed []string
+		// pending is what the interrupted file appended to both logs.
+		pending string
+		// partial is a manifest line cut off by the interruption.
+		partial string
+		// want is what removals.jsonl holds after resuming.
+		want string
+	}{
+		{
+			name:    "no file completed",
+			pending: "{\"file\":\"a\"}\n",
+			want:    "",
+		},
+		{
+			name:      "one file completed",
+			committed: []string{"{\"file\":\"a\"}\n"},
+			pending:   "{\"file\":\"b\"}\n{\"file\":\"b\"",
+			want:      "{\"file\":\"a\"}\n",
+		},
+		{
+			name:      "manifest line cut off",
+			committed: []string{"{\"file\":\"a\"}\n", "{\"file\":\"b\"}\n"},
+			pending:   "{\"file\":\"c\"}\n",
+			partial:   "{\"file\":\"c.txt\",\"sha",
+			want:      "{\"file\":\"a\"}\n{\"file\":\"b\"}\n",
+		},
+		{
+			name:      "logs of an earlier run are kept",
+			before:    "{\"run\":\"earlier\"}\n",
+			committed: []string{"{\"file\":\"a\"}\n"},
+			pending:   "{\"file\":\"b\"}\n",
+			want:      "{\"run\":\"earlier\"}\n{\"file\":\"a\"}\n",
+		},
+		{
+			name:      "nothing pending",
+			committed: []string{"{\"file\":\"a\"}\n"},
+			want:      "{\"file\":\"a\"}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		dir := t.TempDir()
+		if tt.before != "" {
+			appendLog(t, dir, removalsJSONL, tt.before)
+		}
+		cp, err := openCheckpoint(dir, "run-1", "config", logs, false)
+		if err != nil {
+			t.Fatalf("%s: openCheckpoint: %v", tt.name, err)
+		}
+		var files []string
+		for i, line := range tt.committed {
+			file := string(rune('a'+i)) + ".txt"
+			appendLog(t, dir, removalsJSONL, line)
+			appendLog(t, dir, removalLogName("fod"), file+"\n")
+			if err := cp.record(file, "hash", newCleaningStats()); err != nil {
+				t.Fatalf("%s: record: %v", tt.name, err)
+			}
+			files = append(files, file)
+		}
+		if tt.pending != "" {
+			appendLog(t, dir, removalsJSONL, tt.pending)
+			appendLog(t, dir, removalLogName("fod"), tt.pending)
+		}
+		if tt.partial != "" {
+			if _, err := cp.file.WriteString(tt.partial); err != nil {
+				t.Fatal(err)
+			}
+		}
+		cp.Close()
+
+		cp, err = openCheckpoint(dir, "run-2", "config", logs, true)
+		if err != nil {
+			t.Fatalf("%s: resuming: %v", tt.name, err)
+		}
+		if cp.runID != "run-1" {
+			t.Errorf("%s: resumed run ID %q, want run-1", tt.name, cp.runID)
+		}
+		if len(cp.done) != len(files) {
+			t.Errorf("%s: %d files done, want %d", tt.name, len(cp.done), len(files))
+		}
+		for _, file := range files {
+			if _, done := cp.done[file]; !done {
+				t.Errorf("%s: %s is not done", tt.name, file)
+			}
+		}
+		if got := readLog(t, dir, removalsJSONL); got != tt.want {
+			t.Errorf("%s: %s holds %q, want %q", tt.name, removalsJSONL, got, tt.want)
+		}
+		wantFOD := ""
+		for _, file := range files {
+			wantFOD += file + "\n"
+		}
+		if got := readLog(t, dir, removalLogName("fod")); got != wantFOD {
+			t.Errorf("%s: %s holds %q, want %q", tt.name, removalLogName("fod"), got, wantFOD)
+		}
+
+		// The resumed run appends to the manifest after the dropped line.
+		if err := cp.record("z.txt", "hash", newCleaningStats()); err != nil {
+			t.Fatalf("%s: record after resuming: %v", tt.name, err)
+		}
+		cp.Close()
+		cp, err = openCheckpoint(dir, "run-3", "config", logs, true)
+		if err != nil {
+			t.Fatalf("%s: resuming again: %v", tt.name, err)
+		}
+		if _, done := cp.done["z.txt"]; !done || len(cp.done) != len(files)+1 {
+			t.Errorf("%s: after resuming again %d files are done, want %d including z.txt", tt.name, len(cp.done), len(files)+1)
+		}
+		cp.Close()
+	}
+}
+
+func TestCheckpointResumeErrors(t *testing.T) {
+	logs := []string{removalsJSONL}
+	start := func(t *testing.T) string {
+		dir := t.TempDir()
+		cp, err := openCheckpoint(dir, "run-1", "config", logs, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		appendLog(t, dir, removalsJSONL, "{\"file\":\"a\"}\n")
+		if err := cp.record("a.txt", "hash", newCleaningStats()); err != nil {
+			t.Fatal(err)
+		}
+		cp.Close()
+		return dir
+	}
+
+	tests := []struct {
+		name string
+		// change alters the log directory of an interrupted run.
+		change func(t *testing.T, dir string)
+		config string
+		resume bool
+	}{
+		{"manifest left without -resume", func(*testing.T, string) {}, "config", false},
+		{"config changed", func(*testing.T, string) {}, "other config", true},
+		{"log shorter than recorded", func(t *testing.T, dir string) {
+			if err := os.Truncate(filepath.Join(dir, removalsJSONL), 3); err != nil {
+				t.Fatal(err)
+			}
+		}, "config", true},
+		{"log removed", func(t *testing.T, dir string) {
+			if err := os.Remove(filepath.Join(dir, removalsJSONL)); err != nil {
+				t.Fatal(err)
+			}
+		}, "config", true},
+	}
+
+	for _, tt := range tests {
+		dir := start(t)
+		tt.change(t, dir)
+		if cp, err := openCheckpoint(dir, "run-2", tt.config, logs, tt.resume); err == nil {
+			cp.Close()
+			t.Errorf("%s: openCheckpoint succeeded, want an error", tt.name)
+		}
+	}
+}
+
+func TestCheckpointFinishedRunStartsAfresh(t *testing.T) {
+	logs := []string{removalsJSONL}
+	for _, resume := range []bool{false, true} {
+		dir := t.TempDir()
+		cp, err := openCheckpoint(dir, "run-1", "config", logs, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		appendLog(t, dir, removalsJSONL, "{\"file\":\"a\"}\n")
+		if err := cp.record("a.txt", "hash", newCleaningStats()); err != nil {
+			t.Fatal(err)
+		}
+		if err := cp.finish(); err != nil {
+			t.Fatal(err)
+		}
+		cp.Close()
+
+		cp, err = openCheckpoint(dir, "run-2", "other config", logs, resume)
+		if err != nil {
+			t.Fatalf("resume %v: openCheckpoint after a finished run: %v", resume, err)
+		}
+		if cp.runID != "run-2" || len(cp.done) != 0 {
+			t.Errorf("resume %v: got run ID %q with %d files done, want run-2 with none", resume, cp.runID, len(cp.done))
+		}
+		if got, want := readLog(t, dir, removalsJSONL), "{\"file\":\"a\"}\n"; got != want {
+			t.Errorf("resume %v: %s holds %q, want %q", resume, removalsJSONL, got, want)
+		}
+
+		// The new run is interrupted, so the next one has to resume it.
+		if err := cp.record("b.txt", "hash", newCleaningStats()); err != nil {
+			t.Fatal(err)
+		}
+		cp.Close()
+		if cp, err := openCheckpoint(dir, "run-3", "other config", logs, false); err == nil {
+			cp.Close()
+			t.Errorf("resume %v: openCheckpoint of an interrupted run without -resume succeeded", resume)
+		}
+	}
+}
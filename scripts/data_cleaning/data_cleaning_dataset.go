@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// datasetLineBits is how many bits of a dataset position hold the line number.
+const datasetLineBits = 40
+
+// datasetSeq returns the position of a line in the whole dataset: files in
+// walk order, then lines within each file.
+func datasetSeq(file int, lineNo int64) int64 {
+	return int64(file)<<datasetLineBits | lineNo
+}
+
+// splitDatasetSeq is the inverse of datasetSeq.
+func splitDatasetSeq(seq int64) (int, int64) {
+	return int(seq >> datasetLineBits), seq & (1<<datasetLineBits - 1)
+}
+
+// datasetPass runs each dataset-scoped filter over every file of srcDir
+// before cleaning starts, one pass per filter in pipeline order. A pass feeds
+// its filter what reaches it in the cleaning pass: each file goes through the
+// filters before it, file-scoped stateful filters included, and the earlier
+// dataset-scoped filters drop what their passes removed. The verdicts are
+// stored per file under workDir.
+func (c *cleaner) datasetPass(srcDir, workDir string) error {
+	c.dataset = make(map[string]*datasetVerdicts)
+	for i, f := range c.filters {
+		df, isDatasetFilter := f.(DatasetFilter)
+		if !isDatasetFilter || !df.DatasetScope() {
+			continue
+		}
+		dv, err := c.runDatasetPass(srcDir, workDir, df, c.filters[:i])
+		if err != nil {
+			return err
+		}
+		c.dataset[f.Name()] = dv
+	}
+	return nil
+}
+
+// runDatasetPass runs target over every file of srcDir after the filters in before.
+func (c *cleaner) runDatasetPass(srcDir, workDir string, target DatasetFilter, before []Filter) (*datasetVerdicts, error) {
+	fmt.Println("Running dataset pass for " + target.Name())
+	state, err := target.StartDataset(workDir, c.sortMemory)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", target.Name(), err)
+	}
+	file := 0
+	err = walkSources(srcDir, func(src sourceFile) error {
+		if src.isDir {
+			return nil
+		}
+		if err := c.observeFile(src, file, before, state, workDir); err != nil {
+			return fmt.Errorf("%s: %v", src.path, err)
+		}
+		file++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	verdicts, err := state.Verdicts()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", target.Name(), err)
+	}
+	defer verdicts.Close()
+	dir, err := os.MkdirTemp(workDir, "verdicts-*")
+	if err != nil {
+		return nil, err
+	}
+	return splitVerdicts(verdicts, dir)
+}
+
+// observeFile hands every credential of a file that passes the filters in
+// before to state. Nothing is logged: the cleaning pass logs the removals.
+func (c *cleaner) observeFile(src sourceFile, file int, before []Filter, state DatasetState, workDir string) error {
+	tmpDir, err := os.MkdirTemp(workDir, "pass-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	fs, err := openFileSource(src, c.encoding)
+	if err != nil {
+		return err
+	}
+	discard := func(Removal) error { return nil }
+	creds, inline, err := c.chain(file, fs, before, tmpDir, discard)
+	if err != nil {
+		return err
+	}
+	defer creds.Close()
+
+	for {
+		cred, err := nextPassing(creds, inline, discard)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if cred.LineNo >= 1<<datasetLineBits {
+			return fmt.Errorf("more than %d lines", int64(1)<<datasetLineBits-1)
+		}
+		if err := state.Observe(file, cred); err != nil {
+			return err
+		}
+	}
+}
+
+// datasetVerdicts holds the verdicts of a dataset pass, one file of verdicts
+// per source file that has any. It is safe to open several files at the same time.
+type datasetVerdicts struct {
+	paths map[int]string
+}
+
+// splitVerdicts writes verdicts ordered by dataset position into one file per source file in dir.
+func splitVerdicts(verdicts verdictReader, dir string) (*datasetVerdicts, error) {
+	dv := &datasetVerdicts{paths: make(map[int]string)}
+	var out *os.File
+	var w *bufio.Writer
+	closeOut := func() error {
+		if out == nil {
+			return nil
+		}
+		if err := w.Flush(); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	}
+
+	current := -1
+	for {
+		v, err := verdicts.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			closeOut()
+			return nil, err
+		}
+		file, lineNo := splitDatasetSeq(v.LineNo)
+		if file != current {
+			if err := closeOut(); err != nil {
+				return nil, err
+			}
+			current = file
+			dv.paths[file] = filepath.Join(dir, strconv.Itoa(file))
+			if out, err = os.Create(dv.paths[file]); err != nil {
+				return nil, err
+			}
+			w = bufio.NewWriter(out)
+		}
+		if err := writeVarint(w, lineNo); err != nil {
+			closeOut()
+			return nil, err
+		}
+		reason, err := encodeReason(v.Reason)
+		if err == nil {
+			err = writeString(w, reason)
+		}
+		if err != nil {
+			closeOut()
+			return nil, err
+		}
+	}
+	if err := closeOut(); err != nil {
+		return nil, err
+	}
+	return dv, nil
+}
+
+// Open returns the verdicts for one source file, ordered by line.
+func (dv *datasetVerdicts) Open(file int) (verdictReader, error) {
+	path, exists := dv.paths[file]
+	if !exists {
+		return &fileVerdicts{}, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &fileVerdicts{file: f, r: bufio.NewReader(f)}, nil
+}
+
+// fileVerdicts reads one file written by splitVerdicts. The zero value has no verdicts.
+type fileVerdicts struct {
+	file *os.File
+	r    *bufio.Reader
+}
+
+func (v *fileVerdicts) Next() (Verdict, error) {
+	if v.file == nil {
+		return Verdict{}, io.EOF
+	}
+	lineNo, err := readVarint(v.r)
+	if err != nil {
+		return Verdict{}, err
+	}
+	encoded, err := readString(v.r)
+	if err != nil {
+		return Verdict{}, unexpectedEOF(err)
+	}
+	reason, err := decodeReason(encoded)
+	if err != nil {
+		return Verdict{}, err
+	}
+	return Verdict{LineNo: lineNo, Reason: reason}, nil
+}
+
+func (v *fileVerdicts) Close() error {
+	if v.file == nil {
+		return nil
+	}
+	return v.file.Close()
+}
+
+// datasetFileState is the per-file state of a filter that ran in the dataset pass.
+type datasetFileState struct {
+	verdicts verdictReader
+}
+
+func (datasetFileState) Observe(Credential) error { return nil }
+
+func (s datasetFileState) Verdicts() (verdictReader, error) { return s.verdicts, nil }
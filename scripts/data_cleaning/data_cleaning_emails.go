@@ -1,10 +1,258 @@
 package main
 
 import (
-	"fmt"
 	"strings"
 )
 
+func init() {
+	registerFilter("suspicious_email", func(cfg *Config) (Filter, error) {
+		f := suspiciousEmailFilter{
+			sequences: cfg.SuspiciousEmail.Sequences,
+			grouping:  cfg.SuspiciousEmail.Grouping,
+			scope:     cfg.SuspiciousEmail.Scope,
+		}
+		if cfg.SuspiciousEmail.RemoveLearned {
+			learned, err := loadLearnedSequences(cfg.SuspiciousEmail.LearnedFile)
+			if err != nil {
+				return nil, err
+			}
+			f.addLearned(learned)
+		}
+		return f, nil
+	})
+}
+
+// suspiciousEmailFilter removes blocks of emails that follow a suspicious domain sequence.
+type suspiciousEmailFilter struct {
+	sequences [][]string
+	// support holds the support counts of the sequences added by
+	// learn-sequences, by sequenceKey.
+	support map[string]int
+	// grouping and scope are suspicious_email.grouping and .scope.
+	grouping, scope string
+}
+
+// addLearned adds the sequences found by learn-sequences that are not configured already.
+func (f *suspiciousEmailFilter) addLearned(learned []learnedSequence) {
+	configured := make(map[string]bool)
+	for _, seq := range f.sequences {
+		configured[sequenceKey(seq)] = true
+	}
+	f.sequences = append([][]string(nil), f.sequences...)
+	f.support = make(map[string]int)
+	for _, seq := range learned {
+		key := sequenceKey(seq.Domains)
+		if configured[key] {
+			continue
+		}
+		configured[key] = true
+		f.sequences = append(f.sequences, seq.Domains)
+		f.support[key] = seq.Support
+	}
+}
+
+func (suspiciousEmailFilter) Name() string { return "suspicious_email" }
+
+func (f suspiciousEmailFilter) Start(tmpDir string, sortMemory int) (FilterState, error) {
+	if f.grouping == "local_part" {
+		return &localPartState{f.newLocalPartGroups(tmpDir, sortMemory)}, nil
+	}
+	// Determine the maximum block size: max(L+1) over all suspicious sequences.
+	maxBlockSize := 0
+	for _, seq := range f.sequences {
+		if len(seq)+1 > maxBlockSize {
+			maxBlockSize = len(seq) + 1
+		}
+	}
+	return &suspiciousEmailState{
+		sequences:    f.sequences,
+		support:      f.support,
+		maxBlockSize: maxBlockSize,
+		verdicts:     newVerdictSorter(tmpDir, sortMemory),
+	}, nil
+}
+
+// DatasetScope reports whether credentials are grouped across every file
+// rather than within each file.
+func (f suspiciousEmailFilter) DatasetScope() bool { return f.scope == "dataset" }
+
+func (f suspiciousEmailFilter) StartDataset(tmpDir string, sortMemory int) (DatasetState, error) {
+	return &localPartDatasetState{f.newLocalPartGroups(tmpDir, sortMemory)}, nil
+}
+
+// suspiciousEmailState groups contiguous emails with the same local part, up
+// to maxBlockSize, so only one block is held in memory at a time.
+type suspiciousEmailState struct {
+	sequences    [][]string
+	support      map[string]int
+	maxBlockSize int
+	block        []Credential
+	verdicts     *verdictSorter
+}
+
+func (s *suspiciousEmailState) Observe(cred Credential) error {
+	if len(s.block) > 0 && (getLocal(cred.Username) != getLocal(s.block[0].Username) || len(s.block) >= s.maxBlockSize) {
+		if err := s.flush(); err != nil {
+			return err
+		}
+	}
+	s.block = append(s.block, cred)
+	return nil
+}
+
+// flush judges the current block and starts a new one.
+func (s *suspiciousEmailState) flush() error {
+	seq, indices := suspiciousBlock(s.block, s.sequences)
+	for _, k := range indices {
+		if err := s.verdicts.Add(s.block[k].LineNo, sequenceReason(seq, s.support)); err != nil {
+			return err
+		}
+	}
+	s.block = s.block[:0]
+	return nil
+}
+
+func (s *suspiciousEmailState) Verdicts() (verdictReader, error) {
+	if err := s.flush(); err != nil {
+		return nil, err
+	}
+	return s.verdicts.Sort()
+}
+
+// sequenceReason returns the reason for removing a line of a block following
+// seq, with its support if it is a learned sequence.
+func sequenceReason(seq []string, support map[string]int) Reason {
+	reason := Reason{Code: "domain_sequence", Params: map[string]interface{}{"sequence": seq}}
+	if n, learned := support[sequenceKey(seq)]; learned {
+		reason.Params["learned_support"] = n
+	}
+	return reason
+}
+
+// localPartGroups collects credentials by local part and password on disk, and
+// once all are seen tests each group against the suspicious sequences: a
+// group spread over every domain of a sequence is removed from those
+// domains, whatever order and however far apart its lines were.
+type localPartGroups struct {
+	filter     suspiciousEmailFilter
+	tmpDir     string
+	sortMemory int
+	byLocal    *externalSorter
+}
+
+func (f suspiciousEmailFilter) newLocalPartGroups(tmpDir string, sortMemory int) *localPartGroups {
+	return &localPartGroups{
+		filter:     f,
+		tmpDir:     tmpDir,
+		sortMemory: sortMemory,
+		byLocal:    newExternalSorter(tmpDir, sortMemory),
+	}
+}
+
+// add records the credential at position seq.
+func (g *localPartGroups) add(cred Credential, seq int64) error {
+	return addByLocalPart(g.byLocal, cred, seq)
+}
+
+func (g *localPartGroups) Verdicts() (verdictReader, error) {
+	verdicts := newVerdictSorter(g.tmpDir, g.sortMemory)
+	err := forEachLocalPartGroup(g.byLocal, func(group []sortRecord) error {
+		return g.judge(group, verdicts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return verdicts.Sort()
+}
+
+// addByLocalPart adds the credential at position seq to a sorter grouping
+// emails by local part and password, with the domain as the value. Usernames
+// without a domain are left out.
+func addByLocalPart(sorter *externalSorter, cred Credential, seq int64) error {
+	domain := getDomain(cred.Username)
+	if domain == "" {
+		return nil
+	}
+	return sorter.Add(sortRecord{
+		Key:   getLocal(cred.Username) + "\x00" + cred.Password,
+		Seq:   seq,
+		Value: domain,
+	})
+}
+
+// forEachLocalPartGroup sorts the records added by addByLocalPart and calls
+// fn with each local part and password group, in input order.
+func forEachLocalPartGroup(sorter *externalSorter, fn func(group []sortRecord) error) error {
+	var group []sortRecord
+	err := forEachSorted(sorter, func(rec sortRecord) error {
+		if len(group) > 0 && rec.Key != group[0].Key {
+			if err := fn(group); err != nil {
+				return err
+			}
+			group = group[:0]
+		}
+		group = append(group, rec)
+		return nil
+	})
+	if err != nil || len(group) == 0 {
+		return err
+	}
+	return fn(group)
+}
+
+// judge removes the lines of one local part and password group whose domains
+// belong to the first sequence the group covers completely.
+func (g *localPartGroups) judge(group []sortRecord, verdicts *verdictSorter) error {
+	if len(group) < 2 {
+		return nil
+	}
+	domains := make(map[string]bool, len(group))
+	for _, rec := range group {
+		domains[rec.Value] = true
+	}
+	for _, seq := range g.filter.sequences {
+		covered := true
+		for _, domain := range seq {
+			if !domains[domain] {
+				covered = false
+				break
+			}
+		}
+		if !covered {
+			continue
+		}
+		for _, rec := range group {
+			if !contains(seq, rec.Value) {
+				continue
+			}
+			if err := verdicts.Add(rec.Seq, sequenceReason(seq, g.filter.support)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+// localPartState groups the credentials of one file by local part.
+type localPartState struct {
+	*localPartGroups
+}
+
+func (s *localPartState) Observe(cred Credential) error {
+	return s.add(cred, cred.LineNo)
+}
+
+// localPartDatasetState groups the credentials of every file of a run by
+// local part, using dataset positions in place of line numbers.
+type localPartDatasetState struct {
+	*localPartGroups
+}
+
+func (s *localPartDatasetState) Observe(file int, cred Credential) error {
+	return s.add(cred, datasetSeq(file, cred.LineNo))
+}
+
 // getLocal returns the part of the email before the "@".
 func getLocal(email string) string {
 	if at := strings.Index(email, "@"); at != -1 {
@@ -58,125 +306,63 @@ func contains(slice []string, item string) bool {
 	return false
 }
 
-// containsInt checks if an int is in the slice.
-func containsInt(slice []int, item int) bool {
-	for _, s := range slice {
-		if s == item {
-			return true
-		}
-	}
-	return false
-}
-
-// removeSuspiciousEmails processes credentials and removes blocks of emails
-// based on suspicious sequences. Removed credentials are recorded in removedSuspiciousEmail
-// in the format "username:password". It returns new slices of usernames and passwords.
-func removeSuspiciousEmails(usernames, passwords []string, removedSuspiciousEmail *[]string) ([]string, []string) {
-	// Suspicious sequences to check against.
-	suspiciousSequences := [][]string{
-		{"@epost.de", "@gmx.de", "@lycos.de", "@web.de", "@yahoo.de"},
-		{"@inbox.ru", "@list.ru", "@mail.ru", "@rambler.ru", "@yandex.ru"},
-		{"@bk.ru", "@gmail.com", "@gmx.com", "@inbox.ru", "@list.ru", "@mail.ru"},
+// suspiciousBlock checks one block of contiguous emails sharing a local part
+// against the suspicious sequences and returns the matching sequence and the
+// indices of the block to remove.
+func suspiciousBlock(block []Credential, suspiciousSequences [][]string) ([]string, []int) {
+	var blockIndices []int
+	for k := range block {
+		blockIndices = append(blockIndices, k)
 	}
 
-	var newUsernames []string
-	var newPasswords []string
-	n := len(usernames)
-
-	// Determine the maximum block size: max(L+1) over all suspicious sequences.
-	maxBlockSize := 0
+	// Try each suspicious sequence candidate.
 	for _, seq := range suspiciousSequences {
-		if len(seq)+1 > maxBlockSize {
-			maxBlockSize = len(seq) + 1
-		}
-	}
-
-	i := 0
-	for i < n {
-		local := getLocal(usernames[i])
-		var blockIndices []int
-		j := i
-		// Group contiguous emails with the same local part (up to maxBlockSize).
-		for j < n && getLocal(usernames[j]) == local && len(blockIndices) < maxBlockSize {
-			blockIndices = append(blockIndices, j)
-			j++
-		}
-
-		processed := false
-		// Try each suspicious sequence candidate.
-		for _, seq := range suspiciousSequences {
-			L := len(seq)
-			// Case 1: Block length exactly equals L.
-			if len(blockIndices) == L {
-				var blockDomains []string
+		L := len(seq)
+		// Case 1: Block length exactly equals L.
+		if len(blockIndices) == L {
+			var blockDomains []string
+			for _, k := range blockIndices {
+				blockDomains = append(blockDomains, getDomain(block[k].Username))
+			}
+			if slicesEqual(blockDomains, seq) {
+				var blockPasswords []string
 				for _, k := range blockIndices {
-					blockDomains = append(blockDomains, getDomain(usernames[k]))
+					blockPasswords = append(blockPasswords, block[k].Password)
 				}
-				if slicesEqual(blockDomains, seq) {
-					var blockPasswords []string
-					for _, k := range blockIndices {
-						blockPasswords = append(blockPasswords, passwords[k])
-					}
-					if allEqual(blockPasswords) {
-						// Remove the entire block.
-						for _, k := range blockIndices {
-							*removedSuspiciousEmail = append(*removedSuspiciousEmail, fmt.Sprintf("%s:%s", usernames[k], passwords[k]))
-						}
-						processed = true
-						break
-					}
+				if allEqual(blockPasswords) {
+					// Remove the entire block.
+					return seq, blockIndices
 				}
-			} else if len(blockIndices) == L+1 {
-				// Case 2: Block length equals L+1.
-				var suspiciousIdx []int
-				// Identify indices where the domain is in the candidate sequence.
-				for _, k := range blockIndices {
-					domain := getDomain(usernames[k])
-					if contains(seq, domain) {
-						suspiciousIdx = append(suspiciousIdx, k)
-					}
+			}
+		} else if len(blockIndices) == L+1 {
+			// Case 2: Block length equals L+1.
+			var suspiciousIdx []int
+			// Identify indices where the domain is in the candidate sequence.
+			for _, k := range blockIndices {
+				domain := getDomain(block[k].Username)
+				if contains(seq, domain) {
+					suspiciousIdx = append(suspiciousIdx, k)
+				}
+			}
+			if len(suspiciousIdx) == L {
+				var suspiciousBlockDomains []string
+				for _, k := range suspiciousIdx {
+					suspiciousBlockDomains = append(suspiciousBlockDomains, getDomain(block[k].Username))
 				}
-				if len(suspiciousIdx) == L {
-					var suspiciousBlockDomains []string
+				if slicesEqual(suspiciousBlockDomains, seq) {
+					var suspiciousPasswords []string
 					for _, k := range suspiciousIdx {
-						suspiciousBlockDomains = append(suspiciousBlockDomains, getDomain(usernames[k]))
+						suspiciousPasswords = append(suspiciousPasswords, block[k].Password)
 					}
-					if slicesEqual(suspiciousBlockDomains, seq) {
-						var suspiciousPasswords []string
-						for _, k := range suspiciousIdx {
-							suspiciousPasswords = append(suspiciousPasswords, passwords[k])
-						}
-						if allEqual(suspiciousPasswords) {
-							// Remove the suspicious emails.
-							for _, k := range suspiciousIdx {
-								*removedSuspiciousEmail = append(*removedSuspiciousEmail, fmt.Sprintf("%s:%s", usernames[k], passwords[k]))
-							}
-							// Keep the non-suspicious email(s).
-							for _, k := range blockIndices {
-								if !containsInt(suspiciousIdx, k) {
-									newUsernames = append(newUsernames, usernames[k])
-									newPasswords = append(newPasswords, passwords[k])
-								}
-							}
-							processed = true
-							break
-						}
+					if allEqual(suspiciousPasswords) {
+						// Remove the suspicious emails and keep the non-suspicious one.
+						return seq, suspiciousIdx
 					}
 				}
 			}
 		}
-		if processed {
-			i = j // Skip the entire block.
-			continue
-		} else {
-			// If none of the suspicious sequences matched, keep the block unchanged.
-			for _, k := range blockIndices {
-				newUsernames = append(newUsernames, usernames[k])
-				newPasswords = append(newPasswords, passwords[k])
-			}
-			i = j
-		}
 	}
 
-	return newUsernames, newPasswords
+	// If none of the suspicious sequences matched, keep the block unchanged.
+	return nil, nil
 }
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testCredentials parses "username:password" lines, numbering them from 1.
+func testCredentials(lines ...string) []Credential {
+	creds := make([]Credential, len(lines))
+	for i, line := range lines {
+		sep := strings.IndexByte(line, ':')
+		creds[i] = Credential{Username: line[:sep], Password: line[sep+1:], Line: line, LineNo: int64(i + 1)}
+	}
+	return creds
+}
+
+// readVerdicts returns the positions of the verdicts of r, in order.
+func readVerdicts(t *testing.T, r verdictReader) []int64 {
+	t.Helper()
+	defer r.Close()
+	var positions []int64
+	for {
+		v, err := r.Next()
+		if err == io.EOF {
+			return positions
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.Reason.Code != "domain_sequence" {
+			t.Errorf("position %d removed for %q, want domain_sequence", v.LineNo, v.Reason.Code)
+		}
+		positions = append(positions, v.LineNo)
+	}
+}
+
+var testDomainSequences = [][]string{{"@a.com", "@b.com", "@c.com"}}
+
+func TestLocalPartGroups(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		// want are the line numbers removed.
+		want []int64
+	}{
+		{
+			name:  "group covering the sequence",
+			lines: []string{"bob@a.com:pw", "bob@b.com:pw", "bob@c.com:pw"},
+			want:  []int64{1, 2, 3},
+		},
+		{
+			name:  "shuffled and far apart",
+			lines: []string{"bob@c.com:pw", "ann@z.com:x", "bob@a.com:pw", "ann@y.com:x", "eve@q.com:y", "bob@b.com:pw"},
+			want:  []int64{1, 3, 6},
+		},
+		{
+			name:  "domains outside the sequence are kept",
+			lines: []string{"bob@a.com:pw", "bob@d.com:pw", "bob@b.com:pw", "bob@c.com:pw"},
+			want:  []int64{1, 3, 4},
+		},
+		{
+			name:  "one domain missing",
+			lines: []string{"bob@a.com:pw", "bob@c.com:pw", "bob@d.com:pw"},
+		},
+		{
+			name:  "other password is another group",
+			lines: []string{"bob@a.com:pw", "bob@b.com:other", "bob@c.com:pw"},
+		},
+		{
+			name:  "other local part is another group",
+			lines: []string{"bob@a.com:pw", "rob@b.com:pw", "bob@c.com:pw"},
+		},
+		{
+			name:  "usernames without a domain",
+			lines: []string{"bob:pw", "bob@a.com:pw", "bob@b.com:pw"},
+		},
+	}
+
+	f := suspiciousEmailFilter{sequences: testDomainSequences, grouping: "local_part", scope: "file"}
+	for _, tt := range tests {
+		state, err := f.Start(t.TempDir(), 1<<20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, cred := range testCredentials(tt.lines...) {
+			if err := state.Observe(cred); err != nil {
+				t.Fatal(err)
+			}
+		}
+		verdicts, err := state.Verdicts()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := readVerdicts(t, verdicts); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: removed lines %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLocalPartGroupsDatasetScope(t *testing.T) {
+	files := [][]Credential{
+		testCredentials("bob@b.com:pw", "ann@a.com:x"),
+		testCredentials("eve@e.com:y"),
+		testCredentials("ann@b.com:x", "bob@a.com:pw", "bob@c.com:pw"),
+	}
+	f := suspiciousEmailFilter{sequences: testDomainSequences, grouping: "local_part", scope: "dataset"}
+	if !f.DatasetScope() {
+		t.Fatal("DatasetScope is false for scope dataset")
+	}
+
+	state, err := f.StartDataset(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for file, creds := range files {
+		for _, cred := range creds {
+			if err := state.Observe(file, cred); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	verdicts, err := state.Verdicts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []int64{datasetSeq(0, 1), datasetSeq(2, 2), datasetSeq(2, 3)}
+	if got := readVerdicts(t, verdicts); !reflect.DeepEqual(got, want) {
+		t.Errorf("removed positions %v, want %v", got, want)
+	}
+
+	// Within each file on its own the group is incomplete.
+	for file, creds := range files {
+		state, err := f.Start(t.TempDir(), 1<<20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, cred := range creds {
+			if err := state.Observe(cred); err != nil {
+				t.Fatal(err)
+			}
+		}
+		verdicts, err := state.Verdicts()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := readVerdicts(t, verdicts); got != nil {
+			t.Errorf("file %d on its own: removed lines %v, want none", file, got)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"io"
+	"os"
+	"sort"
+)
+
+// sortRecord is one entry of an external sort. Records are ordered by Key, then Seq.
+type sortRecord struct {
+	Key   string
+	Seq   int64
+	Value string
+}
+
+func (r sortRecord) less(other sortRecord) bool {
+	if r.Key != other.Key {
+		return r.Key < other.Key
+	}
+	return r.Seq < other.Seq
+}
+
+// size estimates the memory a buffered record takes.
+func (r sortRecord) size() int {
+	return len(r.Key) + len(r.Value) + 48
+}
+
+// externalSorter sorts more records than fit in memory. Records are buffered
+// until maxBytes is reached, then sorted and spilled to a run file in dir.
+// Sort merges the runs back together.
+type externalSorter struct {
+	dir      string
+	maxBytes int
+	buf      []sortRecord
+	bufBytes int
+	runs     []string
+}
+
+func newExternalSorter(dir string, maxBytes int) *externalSorter {
+	return &externalSorter{dir: dir, maxBytes: maxBytes}
+}
+
+// Add buffers a record, spilling the buffer to disk when it is full.
+func (s *externalSorter) Add(r sortRecord) error {
+	s.buf = append(s.buf, r)
+	s.bufBytes += r.size()
+	if s.bufBytes >= s.maxBytes {
+		return s.spill()
+	}
+	return nil
+}
+
+// spill writes the sorted buffer to a new run file.
+func (s *externalSorter) spill() error {
+	s.sortBuffer()
+	f, err := os.CreateTemp(s.dir, "run-*")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, r := range s.buf {
+		if err := writeSortRecord(w, r); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	s.runs = append(s.runs, f.Name())
+	s.buf = s.buf[:0]
+	s.bufBytes = 0
+	return nil
+}
+
+func (s *externalSorter) sortBuffer() {
+	sort.SliceStable(s.buf, func(i, j int) bool { return s.buf[i].less(s.buf[j]) })
+}
+
+// Sort finishes adding and returns a reader over all records in order.
+// The sorter must not be used afterwards.
+func (s *externalSorter) Sort() (sortedReader, error) {
+	if len(s.runs) == 0 {
+		s.sortBuffer()
+		return &sliceReader{records: s.buf}, nil
+	}
+	if len(s.buf) > 0 {
+		if err := s.spill(); err != nil {
+			return nil, err
+		}
+	}
+	m := &mergeReader{}
+	for _, path := range s.runs {
+		f, err := os.Open(path)
+		if err != nil {
+			m.Close()
+			return nil, err
+		}
+		run := &runReader{file: f, r: bufio.NewReader(f)}
+		if err := run.advance(); err != nil {
+			f.Close()
+			if err == io.EOF {
+				continue
+			}
+			m.Close()
+			return nil, err
+		}
+		m.runs = append(m.runs, run)
+	}
+	heap.Init(m)
+	return m, nil
+}
+
+// forEachSorted sorts s and calls fn for every record in order.
+func forEachSorted(s *externalSorter, fn func(sortRecord) error) error {
+	sorted, err := s.Sort()
+	if err != nil {
+		return err
+	}
+	defer sorted.Close()
+	for {
+		rec, err := sorted.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+}
+
+// sortedReader returns sorted records one at a time. Next returns io.EOF after the last record.
+type sortedReader interface {
+	Next() (sortRecord, error)
+	Close() error
+}
+
+// sliceReader reads records that never left memory.
+type sliceReader struct {
+	records []sortRecord
+	pos     int
+}
+
+func (r *sliceReader) Next() (sortRecord, error) {
+	if r.pos >= len(r.records) {
+		return sortRecord{}, io.EOF
+	}
+	r.pos++
+	return r.records[r.pos-1], nil
+}
+
+func (r *sliceReader) Close() error { return nil }
+
+// runReader reads one spilled run and holds its current record.
+type runReader struct {
+	file    *os.File
+	r       *bufio.Reader
+	current sortRecord
+}
+
+func (run *runReader) advance() error {
+	rec, err := readSortRecord(run.r)
+	if err != nil {
+		return err
+	}
+	run.current = rec
+	return nil
+}
+
+// mergeReader is a k-way merge of run files using a min-heap.
+type mergeReader struct {
+	runs []*runReader
+	err  error
+}
+
+func (m *mergeReader) Len() int           { return len(m.runs) }
+func (m *mergeReader) Less(i, j int) bool { return m.runs[i].current.less(m.runs[j].current) }
+func (m *mergeReader) Swap(i, j int)      { m.runs[i], m.runs[j] = m.runs[j], m.runs[i] }
+func (m *mergeReader) Push(x interface{}) { m.runs = append(m.runs, x.(*runReader)) }
+func (m *mergeReader) Pop() interface{} {
+	run := m.runs[len(m.runs)-1]
+	m.runs = m.runs[:len(m.runs)-1]
+	return run
+}
+
+func (m *mergeReader) Next() (sortRecord, error) {
+	if m.err != nil {
+		return sortRecord{}, m.err
+	}
+	if len(m.runs) == 0 {
+		return sortRecord{}, io.EOF
+	}
+	run := m.runs[0]
+	rec := run.current
+	if err := run.advance(); err != nil {
+		run.file.Close()
+		if err != io.EOF {
+			m.err = err
+			return sortRecord{}, err
+		}
+		heap.Pop(m)
+	} else {
+		heap.Fix(m, 0)
+	}
+	return rec, nil
+}
+
+func (m *mergeReader) Close() error {
+	for _, run := range m.runs {
+		run.file.Close()
+	}
+	m.runs = nil
+	return nil
+}
+
+// writeSortRecord encodes a record as its varint Seq followed by length prefixed Key and Value.
+func writeSortRecord(w *bufio.Writer, r sortRecord) error {
+	if err := writeVarint(w, r.Seq); err != nil {
+		return err
+	}
+	if err := writeString(w, r.Key); err != nil {
+		return err
+	}
+	return writeString(w, r.Value)
+}
+
+func readSortRecord(r *bufio.Reader) (sortRecord, error) {
+	seq, err := binary.ReadVarint(r)
+	if err != nil {
+		return sortRecord{}, err
+	}
+	key, err := readString(r)
+	if err != nil {
+		return sortRecord{}, unexpectedEOF(err)
+	}
+	value, err := readString(r)
+	if err != nil {
+		return sortRecord{}, unexpectedEOF(err)
+	}
+	return sortRecord{Key: key, Seq: seq, Value: value}, nil
+}
+
+func writeVarint(w *bufio.Writer, v int64) error {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(buf[:], v)
+	_, err := w.Write(buf[:n])
+	return err
+}
+
+func readVarint(r *bufio.Reader) (int64, error) {
+	return binary.ReadVarint(r)
+}
+
+func writeString(w *bufio.Writer, s string) error {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], uint64(len(s)))
+	if _, err := w.Write(buf[:n]); err != nil {
+		return err
+	}
+	_, err := w.WriteString(s)
+	return err
+}
+
+func readString(r *bufio.Reader) (string, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// unexpectedEOF turns an EOF in the middle of a record into io.ErrUnexpectedEOF.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// testRecords returns n records with few distinct keys, so that many share a
+// key and are ordered by Seq, added in an order unrelated to Seq.
+func testRecords(n int) []sortRecord {
+	rnd := rand.New(rand.NewSource(1))
+	records := make([]sortRecord, n)
+	for i, seq := range rnd.Perm(n) {
+		records[i] = sortRecord{
+			Key:   fmt.Sprintf("key%03d", rnd.Intn(50)),
+			Seq:   int64(seq),
+			Value: fmt.Sprintf("value %d of record %d", rnd.Intn(1000), seq),
+		}
+	}
+	return records
+}
+
+func TestExternalSorter(t *testing.T) {
+	tests := []struct {
+		name     string
+		records  int
+		maxBytes int
+		// spills is whether the sorter is expected to write runs to disk.
+		spills bool
+	}{
+		{"empty", 0, 1 << 20, false},
+		{"in memory", 1000, 1 << 20, false},
+		{"a run per record", 200, 1, true},
+		{"a few records per run", 2000, 500, true},
+		{"last run partly full", 1001, 1000, true},
+	}
+
+	for _, tt := range tests {
+		dir := t.TempDir()
+		records := testRecords(tt.records)
+		s := newExternalSorter(dir, tt.maxBytes)
+		for _, rec := range records {
+			if err := s.Add(rec); err != nil {
+				t.Fatalf("%s: Add: %v", tt.name, err)
+			}
+		}
+		if spilled := len(s.runs) > 0; spilled != tt.spills {
+			t.Errorf("%s: spilled to %d runs, want spills %v", tt.name, len(s.runs), tt.spills)
+		}
+
+		want := append([]sortRecord(nil), records...)
+		sort.Slice(want, func(i, j int) bool { return want[i].less(want[j]) })
+
+		sorted, err := s.Sort()
+		if err != nil {
+			t.Fatalf("%s: Sort: %v", tt.name, err)
+		}
+		var got []sortRecord
+		for {
+			rec, err := sorted.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: Next: %v", tt.name, err)
+			}
+			got = append(got, rec)
+		}
+		if err := sorted.Close(); err != nil {
+			t.Errorf("%s: Close: %v", tt.name, err)
+		}
+
+		if len(got) != len(want) {
+			t.Errorf("%s: got %d records, want %d", tt.name, len(got), len(want))
+			continue
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s: record %d is %+v, want %+v", tt.name, i, got[i], want[i])
+				break
+			}
+		}
+	}
+}
+
+func TestForEachSortedStopsOnError(t *testing.T) {
+	s := newExternalSorter(t.TempDir(), 100)
+	for _, rec := range testRecords(100) {
+		if err := s.Add(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stop := fmt.Errorf("stop")
+	calls := 0
+	err := forEachSorted(s, func(sortRecord) error {
+		calls++
+		if calls == 10 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || calls != 10 {
+		t.Errorf("forEachSorted returned %v after %d calls, want %v after 10", err, calls, stop)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Credential is a single username/password pair read from a breach file.
+type Credential struct {
+	Username string
+	Password string
+	// Line is the raw input line the credential was parsed from.
+	Line string
+	// LineNo is the 1-based line number of Line in its source file.
+	LineNo int64
+}
+
+// String returns the credential in "username:password" form.
+func (c Credential) String() string {
+	return fmt.Sprintf("%s:%s", c.Username, c.Password)
+}
+
+// Reason says why a filter removes a credential.
+type Reason struct {
+	// Code names the rule that fired, such as "password_length".
+	Code string
+	// Params holds the settings and measurements that made the rule fire.
+	Params map[string]interface{}
+}
+
+// encodeReason turns a reason into a string that can be stored on disk.
+func encodeReason(r Reason) (string, error) {
+	params, err := json.Marshal(r.Params)
+	if err != nil {
+		return "", err
+	}
+	return r.Code + "\x00" + string(params), nil
+}
+
+// decodeReason is the inverse of encodeReason.
+func decodeReason(s string) (Reason, error) {
+	code, params, _ := strings.Cut(s, "\x00")
+	r := Reason{Code: code}
+	if err := json.Unmarshal([]byte(params), &r.Params); err != nil {
+		return Reason{}, fmt.Errorf("reason %s: %v", code, err)
+	}
+	return r, nil
+}
+
+// Removal records a credential dropped by a filter and the reason it was dropped.
+type Removal struct {
+	Credential Credential
+	Filter     string
+	Reason     Reason
+}
+
+// Filter is one cleaning stage. Every filter is either a CredentialFilter, which
+// judges each credential on its own as it streams past, or a StatefulFilter,
+// which has to see every credential of a file before it can decide.
+type Filter interface {
+	Name() string
+}
+
+// CredentialFilter decides on each credential independently.
+type CredentialFilter interface {
+	Filter
+	// Check returns a removal reason and true if cred should be removed.
+	Check(cred Credential) (Reason, bool)
+}
+
+// StatefulFilter decides on all credentials of a file together. The pipeline
+// runs it in two passes: every credential reaching the filter is handed to
+// Observe in input order, then Verdicts says which of them to remove.
+type StatefulFilter interface {
+	Filter
+	// Start returns the state for judging one file. Large state should be
+	// spilled to tmpDir, keeping at most sortMemory bytes in memory at a time.
+	Start(tmpDir string, sortMemory int) (FilterState, error)
+}
+
+// FilterState is the per-file state of a StatefulFilter.
+type FilterState interface {
+	Observe(cred Credential) error
+	// Verdicts returns the credentials to remove, ordered by line number.
+	// It is called once, after the last Observe.
+	Verdicts() (verdictReader, error)
+}
+
+// DatasetFilter is a StatefulFilter that can be configured to compare
+// credentials across every file of a run instead of within each file. When
+// DatasetScope is true the cleaner first runs a dataset pass, handing every
+// credential that would reach the filter to a DatasetState, and then removes
+// from each file what the dataset verdicts say.
+type DatasetFilter interface {
+	StatefulFilter
+	DatasetScope() bool
+	// StartDataset returns the state for judging the whole dataset.
+	StartDataset(tmpDir string, sortMemory int) (DatasetState, error)
+}
+
+// DatasetState is the dataset-wide state of a DatasetFilter.
+type DatasetState interface {
+	// Observe is called for every credential reaching the filter, with the
+	// index of its file in walk order.
+	Observe(file int, cred Credential) error
+	// Verdicts returns the credentials to remove, ordered by the position
+	// given by datasetSeq. It is called once, after the last Observe.
+	Verdicts() (verdictReader, error)
+}
+
+// Verdict is the decision to remove the credential on line LineNo.
+type Verdict struct {
+	LineNo int64
+	Reason Reason
+}
+
+// verdictReader returns verdicts in line order. Next returns io.EOF after the last one.
+type verdictReader interface {
+	Next() (Verdict, error)
+	Close() error
+}
+
+// verdictSorter collects verdicts in any order and returns them sorted by line.
+type verdictSorter struct {
+	sorter *externalSorter
+}
+
+func newVerdictSorter(tmpDir string, sortMemory int) *verdictSorter {
+	return &verdictSorter{sorter: newExternalSorter(tmpDir, sortMemory)}
+}
+
+func (v *verdictSorter) Add(lineNo int64, reason Reason) error {
+	value, err := encodeReason(reason)
+	if err != nil {
+		return err
+	}
+	return v.sorter.Add(sortRecord{Seq: lineNo, Value: value})
+}
+
+func (v *verdictSorter) Sort() (verdictReader, error) {
+	sorted, err := v.sorter.Sort()
+	if err != nil {
+		return nil, err
+	}
+	return sortedVerdicts{sorted}, nil
+}
+
+// sortedVerdicts adapts a sortedReader of verdict records.
+type sortedVerdicts struct {
+	sortedReader
+}
+
+func (s sortedVerdicts) Next() (Verdict, error) {
+	rec, err := s.sortedReader.Next()
+	if err != nil {
+		return Verdict{}, err
+	}
+	reason, err := decodeReason(rec.Value)
+	if err != nil {
+		return Verdict{}, err
+	}
+	return Verdict{LineNo: rec.Seq, Reason: reason}, nil
+}
+
+// logEntryFormatter is implemented by filters that log something other than
+// "username:password" for the credentials they remove.
+type logEntryFormatter interface {
+	LogEntry(cred Credential) string
+}
+
+// filterRegistry maps a filter name to its constructor.
+var filterRegistry = make(map[string]func(cfg *Config) (Filter, error))
+
+// registerFilter makes a filter available by name. It is meant to be called from init.
+func registerFilter(name string, newFilter func(cfg *Config) (Filter, error)) {
+	if _, exists := filterRegistry[name]; exists {
+		panic("filter registered twice: " + name)
+	}
+	filterRegistry[name] = newFilter
+}
+
+// newFilters builds the named filters in the given order.
+func newFilters(names []string, cfg *Config) ([]Filter, error) {
+	var filters []Filter
+	for _, name := range names {
+		newFilter, exists := filterRegistry[name]
+		if !exists {
+			return nil, fmt.Errorf("unknown filter %q", name)
+		}
+		f, err := newFilter(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		switch f.(type) {
+		case CredentialFilter, StatefulFilter:
+		default:
+			return nil, fmt.Errorf("filter %s is neither a CredentialFilter nor a StatefulFilter", name)
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+// parseFilterList splits a comma separated list of filter names.
+func parseFilterList(list string) []string {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
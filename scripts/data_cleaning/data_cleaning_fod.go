@@ -1,54 +1,230 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"regexp"
 	"strings"
 )
 
-// removeSuspiciousFollowOnDistrobution removes passwords manually verified to be botted by follow-on distribution.
-// It accepts slices of usernames and passwords along with a pointer to a slice for removed entries.
-// Returns new slices for usernames and passwords.
-func removeSuspiciousFollowOnDistribution(usernames, passwords []string, removedFOD *[]string) ([]string, []string) {
-	// Define the sets for specific passwords and prefixes.
-	removePasswordsSpecific := map[string]struct{}{
-		"010203kuk": {}, "0000000000o": {}, "1g2w3e4r": {}, "angelseye22": {},
-		"motherlode": {}, "starwarsfan10": {}, "secret666": {}, "sophietorf": {},
-		"Status": {}, "!~!1": {},
+func init() {
+	registerFilter("fod", func(cfg *Config) (Filter, error) {
+		list, err := loadFODList(cfg.FOD.ListFile)
+		if err != nil {
+			return nil, err
+		}
+		return newFODFilter(list)
+	})
+}
+
+// fodListVersion is the version of the filter list format loadFODList reads.
+const fodListVersion = 1
+
+// Match types of a fodEntry.
+const (
+	fodExact     = "exact"
+	fodPrefix    = "prefix"
+	fodSuffix    = "suffix"
+	fodSubstring = "substring"
+	fodRegex     = "regex"
+)
+
+// fodList is the filter list of passwords found by manual review of the
+// follow-on distribution. It is kept under version control next to the
+// config, and each reviewed anomaly adds an entry.
+type fodList struct {
+	// Version is the format of the file, fodListVersion.
+	Version int        `json:"version"`
+	Entries []fodEntry `json:"entries"`
+}
+
+// fodEntry is one reviewed password or password pattern.
+type fodEntry struct {
+	// Match is how Value is compared with a password: "exact", "prefix",
+	// "suffix", "substring" or "regex" (a Go regular expression, matching
+	// anywhere unless anchored).
+	Match string `json:"match"`
+	Value string `json:"value"`
+	// IgnoreCase compares Value without regard to case.
+	IgnoreCase bool `json:"ignore_case"`
+	// Comment says why the entry is on the list.
+	Comment string `json:"comment"`
+	// Reviewer is who reviewed the anomaly; "legacy" marks entries reviewed
+	// before reviewers were recorded.
+	Reviewer string `json:"reviewer"`
+}
+
+// loadFODList reads and checks the filter list at path.
+func loadFODList(path string) (*fodList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening filter list: %v", err)
+	}
+	defer file.Close()
+
+	var list fodList
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&list); err != nil {
+		return nil, fmt.Errorf("error parsing filter list %s: %v", path, err)
+	}
+	if list.Version != fodListVersion {
+		return nil, fmt.Errorf("filter list %s: version %d is not supported (want %d)", path, list.Version, fodListVersion)
+	}
+	for i, entry := range list.Entries {
+		if err := entry.validate(); err != nil {
+			return nil, fmt.Errorf("filter list %s: entry %d (%q): %v", path, i, entry.Value, err)
+		}
 	}
+	return &list, nil
+}
 
-	removePasswordsAll := []string{
-		"111222t", "29rsavoy", "87654321 ", "asdasd5", "jennifer_", "jessica_", "lovely_",
-		"marina_", "natasha_", "nikita_", "NULL", "paSSword", "$HEX", "tinkle",
-		"target123", "victoria_", "valentina_", "vanessa_",
+// validate reports the first problem of an entry. Passwords are trimmed by
+// the parser, so entries that could only match surrounding whitespace are
+// rejected rather than left to never match.
+func (e fodEntry) validate() error {
+	switch {
+	case e.Value == "":
+		return fmt.Errorf("empty value would remove every password")
+	case e.Comment == "":
+		return fmt.Errorf("comment is required")
+	case e.Reviewer == "":
+		return fmt.Errorf("reviewer is required")
 	}
+	leading := strings.TrimLeft(e.Value, " \t") != e.Value
+	trailing := strings.TrimRight(e.Value, " \t") != e.Value
+	switch e.Match {
+	case fodExact:
+		if leading || trailing {
+			return fmt.Errorf("surrounding whitespace can never match a trimmed password")
+		}
+	case fodPrefix:
+		if leading {
+			return fmt.Errorf("leading whitespace can never match a trimmed password")
+		}
+	case fodSuffix:
+		if trailing {
+			return fmt.Errorf("trailing whitespace can never match a trimmed password")
+		}
+	case fodSubstring:
+	case fodRegex:
+		if _, err := regexp.Compile(e.Value); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("match must be %q, %q, %q, %q or %q, not %q", fodExact, fodPrefix, fodSuffix, fodSubstring, fodRegex, e.Match)
+	}
+	return nil
+}
 
-	var newUsernames []string
-	var newPasswords []string
+// fodMatchKinds maps the match types the matcher handles to its kinds.
+var fodMatchKinds = map[string]int{
+	fodExact:     matchExact,
+	fodPrefix:    matchPrefix,
+	fodSuffix:    matchSuffix,
+	fodSubstring: matchSubstring,
+}
 
-	// Process each password by its index.
-	for i, pwd := range passwords {
-		removePass := false
+// fodRegexp is a compiled regex entry.
+type fodRegexp struct {
+	re    *regexp.Regexp
+	entry fodEntry
+}
 
-		// Check if the password exactly matches one in the specific set.
-		if _, found := removePasswordsSpecific[pwd]; found {
-			removePass = true
-		}
+// fodFilter removes passwords manually verified to be botted by follow-on distribution.
+type fodFilter struct {
+	// entries holds the exact, prefix, suffix and substring entries in the
+	// order they are reported in, which are the ids of their patterns.
+	entries []fodEntry
+	// matcher holds the case-sensitive patterns and foldedMatcher the
+	// lower-cased patterns of the entries that ignore case.
+	matcher, foldedMatcher *patternMatcher
+	regexes                []fodRegexp
+}
 
-		// Check if the password starts with any prefix in the all set.
-		for _, prefix := range removePasswordsAll {
-			if strings.HasPrefix(pwd, prefix) {
-				removePass = true
-				break
+// newFODFilter builds the filter from the entries of the reviewed list. The
+// patterns are compiled into one matcher per run, so a password is checked
+// in time independent of the length of the list.
+func newFODFilter(list *fodList) (fodFilter, error) {
+	f := fodFilter{matcher: newPatternMatcher(), foldedMatcher: newPatternMatcher()}
+	// Exact entries come first, then prefixes, suffixes and substrings, each
+	// in list order, as the filter has always reported them.
+	for _, match := range []string{fodExact, fodPrefix, fodSuffix, fodSubstring} {
+		for _, entry := range list.Entries {
+			if entry.Match != match {
+				continue
+			}
+			if entry.IgnoreCase {
+				f.foldedMatcher.add(strings.ToLower(entry.Value), fodMatchKinds[match], len(f.entries))
+			} else {
+				f.matcher.add(entry.Value, fodMatchKinds[match], len(f.entries))
 			}
+			f.entries = append(f.entries, entry)
 		}
+	}
+	f.matcher.compile()
+	f.foldedMatcher.compile()
+
+	for _, entry := range list.Entries {
+		if entry.Match != fodRegex {
+			continue
+		}
+		value := entry.Value
+		if entry.IgnoreCase {
+			value = "(?i)" + value
+		}
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return fodFilter{}, err
+		}
+		f.regexes = append(f.regexes, fodRegexp{re: re, entry: entry})
+	}
+	return f, nil
+}
+
+func (fodFilter) Name() string { return "fod" }
+
+// fodReason returns the reason a password matched entry.
+func fodReason(entry fodEntry) Reason {
+	code := fodReasonCodes[entry.Match]
+	params := map[string]interface{}{code[1]: entry.Value, "reviewer": entry.Reviewer}
+	if entry.IgnoreCase {
+		params["ignore_case"] = true
+	}
+	return Reason{Code: code[0], Params: params}
+}
 
-		if !removePass {
-			newUsernames = append(newUsernames, usernames[i])
-			newPasswords = append(newPasswords, passwords[i])
-		} else {
-			*removedFOD = append(*removedFOD, fmt.Sprintf("%s:%s", usernames[i], pwd))
+// fodReasonCodes maps the match types to the reason codes and the name of the
+// param holding the entry.
+var fodReasonCodes = map[string][2]string{
+	fodExact:     {"exact_match", "entry"},
+	fodPrefix:    {"prefix_match", "prefix"},
+	fodSuffix:    {"suffix_match", "suffix"},
+	fodSubstring: {"substring_match", "substring"},
+	fodRegex:     {"regex_match", "pattern"},
+}
+
+// Check reports whether the password matches an entry of the list: exact
+// entries first, then prefixes, suffixes, substrings and regexes, each in
+// list order.
+func (f fodFilter) Check(cred Credential) (Reason, bool) {
+	pwd := cred.Password
+
+	id, found := f.matcher.match(pwd)
+	if len(f.foldedMatcher.patterns) > 0 {
+		if folded, ok := f.foldedMatcher.match(strings.ToLower(pwd)); ok && (!found || folded < id) {
+			id, found = folded, true
+		}
+	}
+	if found {
+		return fodReason(f.entries[id]), true
+	}
+	for _, r := range f.regexes {
+		if r.re.MatchString(pwd) {
+			return fodReason(r.entry), true
 		}
 	}
 
-	return newUsernames, newPasswords
+	return Reason{}, false
 }
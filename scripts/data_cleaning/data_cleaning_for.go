@@ -6,27 +6,34 @@ import (
 	"os"
 )
 
-// removeSuspiciousFollowOnRatios processes the credentials and removes those
-// with suspicious follow-on ratios. For each removed credential, the username and password
-// are recorded in "[email:password]" format in removedFor.
-// It returns new slices for usernames and passwords. If an error occurs during processing,
-// it is returned.
-func removeSuspiciousFollowOnRatios(usernames, passwords []string, removedFor *[]string) ([]string, []string, error) {
-	// If no passwords, nothing to process.
-	if len(passwords) == 0 {
-		return usernames, passwords, nil
-	}
+func init() {
+	registerFilter("for", func(cfg *Config) (Filter, error) {
+		suspiciousPasswords, err := loadSuspiciousPasswords(cfg.FOR.PasswordsFile)
+		if err != nil {
+			return nil, err
+		}
+		return forFilter{suspiciousPasswords: suspiciousPasswords}, nil
+	})
+}
+
+// forFilter removes credentials with suspicious follow-on ratios.
+type forFilter struct {
+	suspiciousPasswords map[string]bool
+}
 
-	// Load the pre-computed suspicious passwords list
-	file, err := os.Open("./for_passwords_identified.json")
+func (forFilter) Name() string { return "for" }
+
+// loadSuspiciousPasswords loads the pre-computed suspicious passwords list written by identify-for.
+func loadSuspiciousPasswords(passwordsFile string) (map[string]bool, error) {
+	file, err := os.Open(passwordsFile)
 	if err != nil {
-		return nil, nil, fmt.Errorf("error opening suspicious passwords file: %v", err)
+		return nil, fmt.Errorf("error opening suspicious passwords file: %v", err)
 	}
 	defer file.Close()
 
 	var suspiciousPasswordsList []string
 	if err := json.NewDecoder(file).Decode(&suspiciousPasswordsList); err != nil {
-		return nil, nil, fmt.Errorf("error decoding suspicious passwords: %v", err)
+		return nil, fmt.Errorf("error decoding suspicious passwords: %v", err)
 	}
 
 	// Convert to map for faster lookups
@@ -34,19 +41,13 @@ func removeSuspiciousFollowOnRatios(usernames, passwords []string, removedFor *[
 	for _, pwd := range suspiciousPasswordsList {
 		suspiciousPasswords[pwd] = true
 	}
+	return suspiciousPasswords, nil
+}
 
-	// Process each credential
-	var newUsernames, newPasswords []string
-	for idx, pwd := range passwords {
-		if suspiciousPasswords[pwd] {
-			// This password is on the suspicious list
-			*removedFor = append(*removedFor, fmt.Sprintf("%s:%s", usernames[idx], pwd))
-		} else {
-			// Keep this credential
-			newUsernames = append(newUsernames, usernames[idx])
-			newPasswords = append(newPasswords, pwd)
-		}
+// Check reports whether the password is on the suspicious follow-on ratio list.
+func (f forFilter) Check(cred Credential) (Reason, bool) {
+	if f.suspiciousPasswords[cred.Password] {
+		return Reason{Code: "suspicious_ratio", Params: map[string]interface{}{"password": cred.Password}}, true
 	}
-
-	return newUsernames, newPasswords, nil
+	return Reason{}, false
 }
@@ -0,0 +1,528 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// credentialSource yields credentials one at a time. Next returns io.EOF after the last one.
+type credentialSource interface {
+	Next() (Credential, error)
+	Close() error
+}
+
+// fileSource reads credentials from a breach file, decoded as lineReader does.
+// Lines parseCredentialLine rejects are skipped.
+type fileSource struct {
+	lines  *lineReader
+	lineNo int64
+	// parsed counts the credentials returned so far.
+	parsed int
+	// unparsable, if set, is called with every skipped line and the reason it was skipped.
+	unparsable func(lineNo int64, line, reason string) error
+}
+
+func openFileSource(src sourceFile, encoding string) (*fileSource, error) {
+	f, err := src.open()
+	if err != nil {
+		return nil, err
+	}
+	lines, err := newLineReader(src.path, f, encoding)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSource{lines: lines}, nil
+}
+
+func (s *fileSource) Next() (Credential, error) {
+	for s.lines.Scan() {
+		s.lineNo++
+		line := s.lines.Text()
+		username, password, reason, ok := parseCredentialLine(line)
+		if !ok {
+			if s.unparsable != nil {
+				if err := s.unparsable(s.lineNo, line, reason); err != nil {
+					return Credential{}, err
+				}
+			}
+			continue
+		}
+		s.parsed++
+		return Credential{
+			Username: username,
+			Password: password,
+			Line:     line,
+			LineNo:   s.lineNo,
+		}, nil
+	}
+	if err := s.lines.Err(); err != nil {
+		return Credential{}, err
+	}
+	return Credential{}, io.EOF
+}
+
+func (s *fileSource) Close() error {
+	return s.lines.Close()
+}
+
+// spoolWriter stores the credentials that reach a stateful filter, so they can
+// be replayed once its verdicts are known without holding them in memory.
+type spoolWriter struct {
+	file *os.File
+	w    *bufio.Writer
+}
+
+func createSpool(tmpDir string) (*spoolWriter, error) {
+	f, err := os.CreateTemp(tmpDir, "spool-*")
+	if err != nil {
+		return nil, err
+	}
+	return &spoolWriter{file: f, w: bufio.NewWriter(f)}, nil
+}
+
+func (s *spoolWriter) Write(cred Credential) error {
+	if err := writeVarint(s.w, cred.LineNo); err != nil {
+		return err
+	}
+	for _, field := range []string{cred.Username, cred.Password, cred.Line} {
+		if err := writeString(s.w, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reopen finishes writing and returns a source that replays the spool.
+func (s *spoolWriter) Reopen() (*spoolSource, error) {
+	if err := s.w.Flush(); err != nil {
+		s.file.Close()
+		return nil, err
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		s.file.Close()
+		return nil, err
+	}
+	return &spoolSource{file: s.file, r: bufio.NewReader(s.file)}, nil
+}
+
+// spoolSource replays a spool written by spoolWriter.
+type spoolSource struct {
+	file *os.File
+	r    *bufio.Reader
+}
+
+func (s *spoolSource) Next() (Credential, error) {
+	var cred Credential
+	var err error
+	if cred.LineNo, err = readVarint(s.r); err != nil {
+		return Credential{}, err
+	}
+	for _, field := range []*string{&cred.Username, &cred.Password, &cred.Line} {
+		if *field, err = readString(s.r); err != nil {
+			return Credential{}, unexpectedEOF(err)
+		}
+	}
+	return cred, nil
+}
+
+func (s *spoolSource) Close() error {
+	return s.file.Close()
+}
+
+// verdictSource replays a spool and drops the credentials its verdicts remove.
+type verdictSource struct {
+	spool    *spoolSource
+	verdicts verdictReader
+	next     Verdict
+	done     bool
+	filter   Filter
+	removed  func(Removal) error
+}
+
+func newVerdictSource(spool *spoolSource, verdicts verdictReader, f Filter, removed func(Removal) error) (*verdictSource, error) {
+	s := &verdictSource{spool: spool, verdicts: verdicts, filter: f, removed: removed}
+	return s, s.advance()
+}
+
+// advance reads the next verdict.
+func (s *verdictSource) advance() error {
+	v, err := s.verdicts.Next()
+	if err == io.EOF {
+		s.done = true
+		return nil
+	}
+	s.next = v
+	return err
+}
+
+func (s *verdictSource) Next() (Credential, error) {
+	for {
+		cred, err := s.spool.Next()
+		if err != nil {
+			return Credential{}, err
+		}
+		if s.done || cred.LineNo != s.next.LineNo {
+			return cred, nil
+		}
+		if err := s.removed(Removal{Credential: cred, Filter: s.filter.Name(), Reason: s.next.Reason}); err != nil {
+			return Credential{}, err
+		}
+		// A filter may give several reasons for one line; the first one counts.
+		for !s.done && s.next.LineNo == cred.LineNo {
+			if err := s.advance(); err != nil {
+				return Credential{}, err
+			}
+		}
+	}
+}
+
+func (s *verdictSource) Close() error {
+	s.verdicts.Close()
+	return s.spool.Close()
+}
+
+// removalsJSONL is the structured removal log shared by every filter.
+const removalsJSONL = "removals.jsonl"
+
+// removalRecord is one line of removals.jsonl.
+type removalRecord struct {
+	Run    string                 `json:"run"`
+	Filter string                 `json:"filter"`
+	Reason string                 `json:"reason"`
+	Params map[string]interface{} `json:"params,omitempty"`
+	Source string                 `json:"source"`
+	Line   int64                  `json:"line"`
+	Entry  string                 `json:"entry"`
+}
+
+// removalLogs appends removed entries to removed_<filter>.txt and, with their
+// reason and provenance, to removals.jsonl in a log directory. Each log is
+// opened the first time an entry is written to it.
+type removalLogs struct {
+	dir    string
+	runID  string
+	source string
+	// compress gzips the logs and adds .gz to their names.
+	compress bool
+	files    map[string]*outputFile
+}
+
+// unparsableLog holds the lines the parser could not read as a credential.
+const unparsableLog = "unparsable.txt"
+
+// unparsableFilter is the filter name unparsable lines have in removals.jsonl.
+const unparsableFilter = "parse"
+
+// removalLogName returns the file name of a filter's removal log.
+func removalLogName(filter string) string {
+	return "removed_" + filter + ".txt"
+}
+
+// newRemovalLogs returns the logs for the removals of one source file.
+func newRemovalLogs(dir, runID, source string, compress bool) *removalLogs {
+	return &removalLogs{dir: dir, runID: runID, source: source, compress: compress, files: make(map[string]*outputFile)}
+}
+
+// writer returns the writer of a log file, opening it if needed.
+func (l *removalLogs) writer(name string) (*outputFile, error) {
+	if w, open := l.files[name]; open {
+		return w, nil
+	}
+	w, err := createOutput(filepath.Join(l.dir, compressedName(name, l.compress)), l.compress, true)
+	if err != nil {
+		return nil, err
+	}
+	l.files[name] = w
+	return w, nil
+}
+
+func (l *removalLogs) Write(f Filter, r Removal) error {
+	entry := r.Credential.String()
+	if formatter, custom := f.(logEntryFormatter); custom {
+		entry = formatter.LogEntry(r.Credential)
+	}
+	w, err := l.writer(removalLogName(f.Name()))
+	if err != nil {
+		return err
+	}
+	if _, err := w.WriteString(entry + "\n"); err != nil {
+		return err
+	}
+
+	record, err := json.Marshal(removalRecord{
+		Run:    l.runID,
+		Filter: f.Name(),
+		Reason: r.Reason.Code,
+		Params: r.Reason.Params,
+		Source: l.source,
+		Line:   r.Credential.LineNo,
+		Entry:  entry,
+	})
+	if err != nil {
+		return err
+	}
+	if w, err = l.writer(removalsJSONL); err != nil {
+		return err
+	}
+	_, err = w.Write(append(record, '\n'))
+	return err
+}
+
+// Unparsable logs a line the parser rejected to unparsable.txt and removals.jsonl.
+func (l *removalLogs) Unparsable(lineNo int64, line, reason string) error {
+	w, err := l.writer(unparsableLog)
+	if err != nil {
+		return err
+	}
+	if _, err := w.WriteString(line + "\n"); err != nil {
+		return err
+	}
+
+	record, err := json.Marshal(removalRecord{
+		Run:    l.runID,
+		Filter: unparsableFilter,
+		Reason: reason,
+		Source: l.source,
+		Line:   lineNo,
+		Entry:  line,
+	})
+	if err != nil {
+		return err
+	}
+	if w, err = l.writer(removalsJSONL); err != nil {
+		return err
+	}
+	_, err = w.Write(append(record, '\n'))
+	return err
+}
+
+// Close flushes and closes every open log. It is safe to call more than once.
+func (l *removalLogs) Close() error {
+	var firstErr error
+	for name, file := range l.files {
+		if err := file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(l.files, name)
+	}
+	return firstErr
+}
+
+// processFile cleans one input file into destPath and the removal logs in logDir.
+func (c *cleaner) processFile(file int, input sourceFile, destPath, separatePath, logDir string) (CleaningStats, error) {
+	fmt.Println("Currently processing: " + input.path)
+	start := time.Now()
+	fileStats := newCleaningStats()
+
+	tmpDir, err := os.MkdirTemp(c.tmpDir, "clean-*")
+	if err != nil {
+		return fileStats, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var logs *removalLogs
+	if !c.dryRun {
+		logs = newRemovalLogs(logDir, c.runID, input.path, c.compress)
+		defer logs.Close()
+	}
+
+	filtersByName := make(map[string]Filter)
+	for _, f := range c.filters {
+		filtersByName[f.Name()] = f
+	}
+	removed := func(r Removal) error {
+		fileStats.remove(r.Filter, r.Reason.Code)
+		if logs == nil {
+			return nil
+		}
+		return logs.Write(filtersByName[r.Filter], r)
+	}
+
+	fs, err := openFileSource(input, c.encoding)
+	if err != nil {
+		return fileStats, err
+	}
+	fs.unparsable = func(lineNo int64, line, reason string) error {
+		fileStats.unparsable[reason]++
+		if logs == nil {
+			return nil
+		}
+		return logs.Unparsable(lineNo, line, reason)
+	}
+	src, inline, err := c.chain(file, fs, c.filters, tmpDir, removed)
+	if err != nil {
+		return fileStats, err
+	}
+	defer src.Close()
+
+	// Run the remaining credential filters and write what is left.
+	var writer, separate *outputFile
+	if !c.dryRun {
+		if writer, err = createOutput(destPath, c.compress, false); err != nil {
+			return fileStats, err
+		}
+		defer writer.file.Close()
+	}
+	for {
+		cred, err := nextPassing(src, inline, removed)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fileStats, err
+		}
+		fileStats.kept++
+		line := cred.String()
+		w := writer
+		if separatePath != "" && !isASCII(line) {
+			fileStats.separated++
+			if !c.dryRun && separate == nil {
+				// The separate file is only created once it has an entry.
+				if separate, err = createOutput(separatePath, c.compress, false); err != nil {
+					return fileStats, err
+				}
+				defer separate.file.Close()
+			}
+			w = separate
+		}
+		if w != nil {
+			if _, err := w.WriteString(line + "\n"); err != nil {
+				return fileStats, err
+			}
+		}
+	}
+	for _, w := range []*outputFile{writer, separate} {
+		if w != nil {
+			if err := w.Close(); err != nil {
+				return fileStats, err
+			}
+		}
+	}
+	if logs != nil {
+		if err := logs.Close(); err != nil {
+			return fileStats, err
+		}
+	}
+
+	fileStats.inputLines = fs.lineNo
+	fileStats.encoding = fs.lines.encoding
+	fileStats.encodingLines = fs.lines.lines
+	fileStats.totalProcessed = fs.parsed
+	fileStats.duration = time.Since(start)
+	return fileStats, nil
+}
+
+// chain streams the credentials of src through filters: credential filters
+// run as records flow past, and each stateful filter spools the records that
+// reach it to tmpDir until its verdicts are known. It returns the source of
+// the credentials that pass the last stateful filter, and the credential
+// filters after it, which are left to the caller. src is closed if chain
+// fails.
+func (c *cleaner) chain(file int, src credentialSource, filters []Filter, tmpDir string, removed func(Removal) error) (credentialSource, []CredentialFilter, error) {
+	var inline []CredentialFilter
+	for _, f := range filters {
+		if cf, isCredentialFilter := f.(CredentialFilter); isCredentialFilter {
+			inline = append(inline, cf)
+			continue
+		}
+		next, err := c.runStateful(f.(StatefulFilter), file, src, inline, tmpDir, removed)
+		if err != nil {
+			return nil, nil, err
+		}
+		src, inline = next, nil
+	}
+	return src, inline, nil
+}
+
+// runStateful runs everything in inline and then the stateful filter f over
+// src, spooling what reaches f, and returns the source replaying the spool
+// without the credentials f removes. src is closed.
+func (c *cleaner) runStateful(f StatefulFilter, file int, src credentialSource, inline []CredentialFilter, tmpDir string, removed func(Removal) error) (credentialSource, error) {
+	state, err := c.startState(f, file, tmpDir)
+	if err != nil {
+		src.Close()
+		return nil, fmt.Errorf("%s: %v", f.Name(), err)
+	}
+	spool, err := createSpool(tmpDir)
+	if err != nil {
+		src.Close()
+		return nil, err
+	}
+	for {
+		cred, err := nextPassing(src, inline, removed)
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			if err = state.Observe(cred); err != nil {
+				err = fmt.Errorf("%s: %v", f.Name(), err)
+			}
+		}
+		if err == nil {
+			err = spool.Write(cred)
+		}
+		if err != nil {
+			spool.file.Close()
+			src.Close()
+			return nil, err
+		}
+	}
+	src.Close()
+
+	replay, err := spool.Reopen()
+	if err != nil {
+		return nil, err
+	}
+	verdicts, err := state.Verdicts()
+	if err != nil {
+		replay.Close()
+		return nil, fmt.Errorf("%s: %v", f.Name(), err)
+	}
+	vs, err := newVerdictSource(replay, verdicts, f, removed)
+	if err != nil {
+		vs.Close()
+		return nil, err
+	}
+	return vs, nil
+}
+
+// nextPassing pulls the next credential of src that survives the credential
+// filters in inline, reporting the others to removed.
+func nextPassing(src credentialSource, inline []CredentialFilter, removed func(Removal) error) (Credential, error) {
+nextCredential:
+	for {
+		cred, err := src.Next()
+		if err != nil {
+			return Credential{}, err
+		}
+		for _, f := range inline {
+			if reason, remove := f.Check(cred); remove {
+				if err := removed(Removal{Credential: cred, Filter: f.Name(), Reason: reason}); err != nil {
+					return Credential{}, err
+				}
+				continue nextCredential
+			}
+		}
+		return cred, nil
+	}
+}
+
+// startState starts a stateful filter on one file. A filter that ran in the
+// dataset pass has already judged the file, so its state just replays the
+// file's verdicts.
+func (c *cleaner) startState(sf StatefulFilter, file int, tmpDir string) (FilterState, error) {
+	dv, inDataset := c.dataset[sf.Name()]
+	if !inDataset {
+		return sf.Start(tmpDir, c.sortMemory)
+	}
+	verdicts, err := dv.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	return datasetFileState{verdicts}, nil
+}
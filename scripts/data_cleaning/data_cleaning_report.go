@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// statsReport is the machine-readable form of CleaningStats.
+type statsReport struct {
+	// File is the input path relative to the source directory; it is empty for the totals.
+	File string `json:"file,omitempty"`
+	// Encoding is the encoding detected for the file; EncodingLines counts
+	// its lines by the encoding they were decoded with.
+	Encoding        string           `json:"encoding,omitempty"`
+	EncodingLines   map[string]int64 `json:"encoding_lines"`
+	InputLines      int64            `json:"input_lines"`
+	UnparsableLines int64            `json:"unparsable_lines"`
+	// Unparsable counts the unparsable lines by the parser's reason.
+	Unparsable  map[string]int `json:"unparsable"`
+	ParsedLines int            `json:"parsed_lines"`
+	Kept        int            `json:"kept"`
+	// Separated counts the kept credentials written to the separate non-ASCII output.
+	Separated int `json:"separated"`
+	// Removed counts removals by filter, Reasons by filter and reason code.
+	Removed map[string]int            `json:"removed"`
+	Reasons map[string]map[string]int `json:"reasons"`
+	Seconds float64                   `json:"seconds"`
+}
+
+func (s CleaningStats) report(file string) statsReport {
+	return statsReport{
+		File:            file,
+		Encoding:        s.encoding,
+		EncodingLines:   s.encodingLines,
+		InputLines:      s.inputLines,
+		UnparsableLines: s.inputLines - int64(s.totalProcessed),
+		Unparsable:      s.unparsable,
+		ParsedLines:     s.totalProcessed,
+		Kept:            s.kept,
+		Separated:       s.separated,
+		Removed:         s.removals,
+		Reasons:         s.reasons,
+		Seconds:         s.duration.Seconds(),
+	}
+}
+
+func (r statsReport) stats() CleaningStats {
+	stats := newCleaningStats()
+	stats.add(CleaningStats{
+		inputLines:     r.InputLines,
+		totalProcessed: r.ParsedLines,
+		kept:           r.Kept,
+		separated:      r.Separated,
+		removals:       r.Removed,
+		reasons:        r.Reasons,
+		unparsable:     r.Unparsable,
+		encodingLines:  r.EncodingLines,
+		duration:       time.Duration(r.Seconds * float64(time.Second)),
+	})
+	stats.encoding = r.Encoding
+	return stats
+}
+
+// runReport describes a whole clean or count run.
+type runReport struct {
+	RunID   string    `json:"run_id"`
+	DryRun  bool      `json:"dry_run"`
+	Started time.Time `json:"started"`
+	// Seconds is the wall time of this invocation, including the dataset pass.
+	Seconds            float64       `json:"seconds"`
+	DatasetPassSeconds float64       `json:"dataset_pass_seconds"`
+	Filters            []string      `json:"filters"`
+	Files              []statsReport `json:"files"`
+	Total              statsReport   `json:"total"`
+}
+
+// writeReport writes the report to path.json and, one row per file and a
+// final row for the totals, to path.csv.
+func writeReport(path string, r runReport) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(r, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".json", append(data, '\n'), 0644); err != nil {
+		return err
+	}
+
+	// Reason columns are the union of the reasons seen, sorted, after the filter totals.
+	var reasonColumns [][2]string
+	seen := make(map[[2]string]bool)
+	for _, filter := range r.Filters {
+		var codes []string
+		for code := range r.Total.Reasons[filter] {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		for _, code := range codes {
+			if col := [2]string{filter, code}; !seen[col] {
+				seen[col] = true
+				reasonColumns = append(reasonColumns, col)
+			}
+		}
+	}
+
+	file, err := os.Create(path + ".csv")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	w := csv.NewWriter(file)
+	parseReasons := []string{parseNoSeparator, parseEmptyIdentifier, parseInvalidIdentifier}
+	header := []string{"file", "encoding", "input_lines", "unparsable_lines"}
+	for _, reason := range parseReasons {
+		header = append(header, unparsableFilter+":"+reason)
+	}
+	header = append(header, "parsed_lines", "kept", "separated", "seconds")
+	for _, filter := range r.Filters {
+		header = append(header, "removed_"+filter)
+	}
+	for _, col := range reasonColumns {
+		header = append(header, col[0]+":"+col[1])
+	}
+	w.Write(header)
+	row := func(name string, s statsReport) {
+		fields := []string{
+			name,
+			s.Encoding,
+			strconv.FormatInt(s.InputLines, 10),
+			strconv.FormatInt(s.UnparsableLines, 10),
+		}
+		for _, reason := range parseReasons {
+			fields = append(fields, strconv.Itoa(s.Unparsable[reason]))
+		}
+		fields = append(fields,
+			strconv.Itoa(s.ParsedLines),
+			strconv.Itoa(s.Kept),
+			strconv.Itoa(s.Separated),
+			strconv.FormatFloat(s.Seconds, 'f', 3, 64),
+		)
+		for _, filter := range r.Filters {
+			fields = append(fields, strconv.Itoa(s.Removed[filter]))
+		}
+		for _, col := range reasonColumns {
+			fields = append(fields, strconv.Itoa(s.Reasons[col[0]][col[1]]))
+		}
+		w.Write(fields)
+	}
+	for _, f := range r.Files {
+		row(f.File, f)
+	}
+	row("TOTAL", r.Total)
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("Report written to %s.json and %s.csv\n", path, path)
+	return nil
+}
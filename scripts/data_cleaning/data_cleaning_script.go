@@ -1,381 +1,617 @@
 package main
 
 import (
-	"bufio"
+	"flag"
 	"fmt"
-	"log"
-	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
-	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/width"
 )
 
-// SeqInfo holds tracking info for sequential usernames.
-type SeqInfo struct {
-	lastNumber   int
-	count        int
-	startRemoval bool
-}
-
 var (
 	// allowedControlChars: only tab (9), newline (10), and carriage return (13) are allowed below 32.
 	allowedControlChars = map[rune]bool{9: true, 10: true, 13: true}
-	// sequentialUsernames maps "base@domain" to sequence information.
-	sequentialUsernames = make(map[string]SeqInfo)
+	// sequentialRe splits an email into base name, number suffix and domain.
+	sequentialRe = regexp.MustCompile(`^([a-zA-Z0-9._%+\-]+?)(\d+)@(.+)$`)
 )
 
-// remove fbobh_ entries
-func removeFBOB(usernames, passwords []string, removedFBOB *[]string) ([]string, []string) {
-	// Process each credential.
-	var newUsernames, newPasswords []string
-	for idx, pwd := range passwords {
-		if strings.HasPrefix(pwd, "fbobh_") {
-			*removedFBOB = append(*removedFBOB, fmt.Sprintf("%s:%s", usernames[idx], pwd))
-		} else {
-			newUsernames = append(newUsernames, usernames[idx])
-			newPasswords = append(newPasswords, pwd)
+func init() {
+	registerFilter("prior_work", func(cfg *Config) (Filter, error) { return priorWorkFilter{cfg: cfg.PriorWork}, nil })
+	registerFilter("rule_based", func(cfg *Config) (Filter, error) {
+		validator, err := newEmailValidator(cfg.RuleBased.TLDFile)
+		if err != nil {
+			return nil, err
 		}
+		return ruleBasedFilter{cfg: cfg.RuleBased, validator: validator}, nil
+	})
+	registerFilter("FBOB", func(cfg *Config) (Filter, error) { return fbobFilter{}, nil })
+}
+
+// fbobFilter removes fbobh_ entries.
+type fbobFilter struct{}
+
+func (fbobFilter) Name() string { return "FBOB" }
+
+func (fbobFilter) Check(cred Credential) (Reason, bool) {
+	if strings.HasPrefix(cred.Password, "fbobh_") {
+		return Reason{Code: "fbobh_prefix", Params: map[string]interface{}{"prefix": "fbobh_"}}, true
 	}
-	return newUsernames, newPasswords
+	return Reason{}, false
 }
 
-// detectSequentialUsernames detects sequences of 100 or more usernames with an incrementing number suffix
-func detectSequentialUsernames(email string, sequentialUsernames map[string]SeqInfo) bool {
-	re := regexp.MustCompile(`^([a-zA-Z0-9._%+\-]+?)(\d+)@(.+)$`)
-	matches := re.FindStringSubmatch(email)
+// sequenceRecord returns the record sorted by checkSequences for an email at
+// position seq, and false if the email has no number before the "@". Zero
+// padding is ignored, so user007 and user7 have the same number.
+func sequenceRecord(email string, seq int64) (sortRecord, bool) {
+	matches := sequentialRe.FindStringSubmatch(email)
 	if matches == nil || len(matches) < 4 {
-		return false
+		return sortRecord{}, false
 	}
 
 	baseName := matches[1]
 	numberStr := matches[2]
 	domain := matches[3]
-	number, err := strconv.Atoi(numberStr)
+	number, err := strconv.ParseInt(numberStr, 10, 64)
 	if err != nil {
-		return false
+		return sortRecord{}, false
 	}
+	return sortRecord{
+		Key:   fmt.Sprintf("%s@%s", baseName, domain),
+		Seq:   number,
+		Value: strconv.FormatInt(seq, 10),
+	}, true
+}
 
-	key := fmt.Sprintf("%s@%s", baseName, domain)
-
-	if seq, exists := sequentialUsernames[key]; exists {
-		if number == seq.lastNumber+1 {
-			seq.count++
-			seq.startRemoval = seq.startRemoval || (seq.count >= 100)
-			seq.lastNumber = number
-			sequentialUsernames[key] = seq
-		} else {
-			sequentialUsernames[key] = SeqInfo{lastNumber: number, count: 1, startRemoval: false}
+// checkSequences finds runs of numbered usernames in records made by
+// sequenceRecord. A run is a set of usernames with the same base@domain whose
+// sorted numbers are at most maxGap apart; once it has sequenceLength distinct
+// numbers every username in it is removed, wherever it appears in the input.
+func checkSequences(bySequence *externalSorter, sequenceLength int, maxGap int64, verdicts *verdictSorter) error {
+	// run holds the positions of the current run until it is long enough.
+	var run []int64
+	prevKey, prevNumber, first := "", int64(0), true
+	distinct, removing := 0, false
+	return forEachSorted(bySequence, func(rec sortRecord) error {
+		seq, err := strconv.ParseInt(rec.Value, 10, 64)
+		if err != nil {
+			return err
 		}
-	} else {
-		sequentialUsernames[key] = SeqInfo{lastNumber: number, count: 1, startRemoval: false}
-	}
+		if first || rec.Key != prevKey || rec.Seq-prevNumber > maxGap {
+			run, distinct, removing = run[:0], 1, false
+		} else if rec.Seq != prevNumber {
+			distinct++
+		}
+		prevKey, prevNumber, first = rec.Key, rec.Seq, false
+
+		reason := Reason{Code: "sequential", Params: map[string]interface{}{
+			"run":             rec.Key,
+			"sequence_length": sequenceLength,
+			"max_gap":         maxGap,
+		}}
+		if removing {
+			return verdicts.Add(seq, reason)
+		}
+		run = append(run, seq)
+		if distinct < sequenceLength {
+			return nil
+		}
+		removing = true
+		for _, pos := range run {
+			if err := verdicts.Add(pos, reason); err != nil {
+				return err
+			}
+		}
+		run = run[:0]
+		return nil
+	})
+}
+
+// priorWorkFilter applies the checks used by prior work on breach cleaning.
+type priorWorkFilter struct {
+	cfg PriorWorkConfig
+}
+
+func (priorWorkFilter) Name() string { return "prior_work" }
 
-	return sequentialUsernames[key].startRemoval
+// LogEntry logs the original line, since the failing character may not be part of the password.
+func (priorWorkFilter) LogEntry(cred Credential) string {
+	return strings.TrimSpace(cred.Line)
 }
 
-// priorWorkChecks performs various checks on a credential line and returns true if the credential passes.
-func priorWorkChecks(credential, email, password string, removedPriorWorks *[]string) bool {
-	trimCred := strings.TrimSpace(credential)
-	// Check for non-ascii characters outside allowed control chars.
-	for _, r := range credential {
-		if (r < 32 && !allowedControlChars[r]) || r > 126 {
-			*removedPriorWorks = append(*removedPriorWorks, trimCred)
-			return false
+// Check performs various checks on a credential line and returns the reason it fails, if any.
+// Lengths are counted in characters, not bytes.
+func (f priorWorkFilter) Check(cred Credential) (Reason, bool) {
+	password := cred.Password
+	for _, r := range cred.Line {
+		// Check for non-ascii characters outside allowed control chars.
+		if f.cfg.NonASCII == "drop" {
+			if (r < 32 && !allowedControlChars[r]) || r > 126 {
+				return Reason{Code: "non_ascii", Params: map[string]interface{}{"char": string(r)}}, true
+			}
+			continue
+		}
+		// Unicode is allowed, but control characters and the replacement
+		// character of undecodable input are not.
+		if (unicode.IsControl(r) && !allowedControlChars[r]) || r == utf8.RuneError {
+			return Reason{Code: "invalid_char", Params: map[string]interface{}{"char": string(r)}}, true
 		}
 	}
 	// Check password length constraints.
-	if len(password) < 4 || len(password) > 30 {
-		*removedPriorWorks = append(*removedPriorWorks, trimCred)
-		return false
+	length := utf8.RuneCountInString(password)
+	if length < f.cfg.MinPasswordLength || length > f.cfg.MaxPasswordLength {
+		return Reason{Code: "password_length", Params: map[string]interface{}{
+			"length": length,
+			"min":    f.cfg.MinPasswordLength,
+			"max":    f.cfg.MaxPasswordLength,
+		}}, true
 	}
-	// Check if password is all hexadecimal when long enough.
-	if len(password) >= 20 {
+	// Check if password is all hexadecimal when long enough. Fullwidth
+	// digits and letters count as their ASCII forms.
+	if length >= f.cfg.HexLength {
 		allHex := true
-		for _, ch := range password {
+		for _, ch := range width.Fold.String(password) {
 			if !strings.ContainsRune("0123456789abcdefABCDEF", ch) {
 				allHex = false
 				break
 			}
 		}
 		if allHex {
-			*removedPriorWorks = append(*removedPriorWorks, trimCred)
-			return false
+			return Reason{Code: "hex_password", Params: map[string]interface{}{
+				"length":     length,
+				"hex_length": f.cfg.HexLength,
+			}}, true
 		}
 	}
-	return true
+	return Reason{}, false
 }
 
-func removeRuleBased(usernames, passwords []string, removedRuleBased *[]string) ([]string, []string) {
-	// Prepare output lists
-	filteredUsernames := []string{}
-	filteredPasswords := []string{}
-
-	// Track duplicates
-	duplicates := make(map[string]int)
-	emailDuplicates := make(map[string]int)
-
-	// Process each credential
-	for i := range usernames {
-		email := usernames[i]
-		password := passwords[i]
-		credential := fmt.Sprintf("%s:%s", email, password)
-
-		// Check for duplicate credentials
-		duplicates[credential]++
-		if duplicates[credential] > 1 {
-			*removedRuleBased = append(*removedRuleBased, credential)
-			continue
-		}
+// ruleBasedFilter applies duplicate, email format and sequential username rules.
+type ruleBasedFilter struct {
+	cfg       RuleBasedConfig
+	validator *emailValidator
+}
 
-		// Check email length
-		if len(email) < 10 || len(email) > 40 {
-			*removedRuleBased = append(*removedRuleBased, credential)
-			continue
-		}
+func (ruleBasedFilter) Name() string { return "rule_based" }
 
-		// Validate email format
-		emailRe := regexp.MustCompile(`^[_a-zA-Z0-9\-]+(\.[_a-zA-Z0-9\-]+)*@[a-zA-Z0-9\-]+(\.[a-zA-Z0-9\-]+)*(\.[a-zA-Z]{2,4})$`)
-		if !emailRe.MatchString(email) {
-			*removedRuleBased = append(*removedRuleBased, credential)
-			continue
-		}
+func (f ruleBasedFilter) Start(tmpDir string, sortMemory int) (FilterState, error) {
+	return &ruleBasedState{
+		filter:       f,
+		tmpDir:       tmpDir,
+		sortMemory:   sortMemory,
+		byCredential: newExternalSorter(tmpDir, sortMemory),
+	}, nil
+}
 
-		// Check if the same email appears more than 100 times
-		emailDuplicates[email]++
-		if emailDuplicates[email] > 100 {
-			*removedRuleBased = append(*removedRuleBased, credential)
-			continue
-		}
+// DatasetScope reports whether the rules are checked across every file rather
+// than within each file.
+func (f ruleBasedFilter) DatasetScope() bool { return f.cfg.Scope == "dataset" }
+
+func (f ruleBasedFilter) StartDataset(tmpDir string, sortMemory int) (DatasetState, error) {
+	return &ruleBasedDatasetState{ruleBasedState{
+		filter:       f,
+		tmpDir:       tmpDir,
+		sortMemory:   sortMemory,
+		byCredential: newExternalSorter(tmpDir, sortMemory),
+	}}, nil
+}
 
-		// Check sequential username rule
-		if detectSequentialUsernames(email, sequentialUsernames) {
-			*removedRuleBased = append(*removedRuleBased, credential)
-			continue
-		}
+// emailReason returns why an email fails the length check or the checks of
+// emailValidator.check, and false if it passes them.
+func (f ruleBasedFilter) emailReason(email string) (Reason, bool) {
+	// Check email length
+	length := utf8.RuneCountInString(email)
+	if length < f.cfg.MinEmailLength || length > f.cfg.MaxEmailLength {
+		return Reason{Code: "email_length", Params: map[string]interface{}{
+			"length": length,
+			"min":    f.cfg.MinEmailLength,
+			"max":    f.cfg.MaxEmailLength,
+		}}, true
+	}
+	return f.validator.check(email)
+}
+
+// emailKey returns the form of an email the rules compare: the canonical
+// form if rule_based.canonical_emails is set, and the email itself if not.
+func (f ruleBasedFilter) emailKey(email string) string {
+	if f.cfg.CanonicalEmails {
+		return canonicalEmail(email)
+	}
+	return email
+}
 
-		// If all checks pass, add to filtered lists
-		filteredUsernames = append(filteredUsernames, email)
-		filteredPasswords = append(filteredPasswords, password)
+// emailReasonParams adds the canonical form of email to the params of a
+// reason when it differs from email, so the log shows why two spellings matched.
+func (f ruleBasedFilter) emailReasonParams(reason Reason, email string) Reason {
+	if key := f.emailKey(email); key != email {
+		if reason.Params == nil {
+			reason.Params = make(map[string]interface{})
+		}
+		reason.Params["canonical_email"] = key
 	}
+	return reason
+}
+
+// ruleBasedState applies the rules of ruleBasedFilter to one file. The rules
+// run in order on whatever survived the earlier ones: duplicates, email
+// length and format, credentials per email, and sequential usernames. Each
+// rule compares credentials by sorting them on disk first.
+type ruleBasedState struct {
+	filter     ruleBasedFilter
+	tmpDir     string
+	sortMemory int
+	// byCredential sorts credentials so that duplicates end up next to each other.
+	byCredential *externalSorter
+}
 
-	return filteredUsernames, filteredPasswords
+func (s *ruleBasedState) Observe(cred Credential) error {
+	return s.add(cred, cred.LineNo)
 }
 
-// priorWorksCleaning processes one file: it reads the file (using latin1 decoding),
-// checks each line, and writes the cleaned credentials to memory (returned as slices).
-// It also appends any removed entries to removedpriorWorks.
-func priorWorksCleaning(filePath string, usernames *[]string, passwords *[]string, removedPriorWorks *[]string) error {
-	f, err := os.Open(filePath)
+// add records the credential at position seq. Whether its email fails a
+// check is worked out once here; the reason is rebuilt when it is removed.
+func (s *ruleBasedState) add(cred Credential, seq int64) error {
+	failed := ""
+	if _, fails := s.filter.emailReason(cred.Username); fails {
+		failed = "x"
+	}
+	return s.byCredential.Add(sortRecord{
+		Key:   s.filter.emailKey(cred.Username) + ":" + cred.Password,
+		Seq:   seq,
+		Value: failed + "\x00" + cred.Username,
+	})
+}
+
+func (s *ruleBasedState) Verdicts() (verdictReader, error) {
+	verdicts := newVerdictSorter(s.tmpDir, s.sortMemory)
+
+	// Check for duplicate credentials, then the email of each first occurrence.
+	byEmail := newExternalSorter(s.tmpDir, s.sortMemory)
+	prevCredential, first := "", true
+	err := forEachSorted(s.byCredential, func(rec sortRecord) error {
+		failed, email, _ := strings.Cut(rec.Value, "\x00")
+		if !first && rec.Key == prevCredential {
+			return verdicts.Add(rec.Seq, s.filter.emailReasonParams(Reason{Code: "duplicate"}, email))
+		}
+		prevCredential, first = rec.Key, false
+		if failed != "" {
+			reason, _ := s.filter.emailReason(email)
+			return verdicts.Add(rec.Seq, reason)
+		}
+		return byEmail.Add(sortRecord{Key: s.filter.emailKey(email), Seq: rec.Seq, Value: email})
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer f.Close()
-
-	fmt.Println("Currently processing: " + filePath)
-
-	decoder := charmap.ISO8859_1.NewDecoder()
-	reader := decoder.Reader(f)
-	scanner := bufio.NewScanner(reader)
-	// Increase maximum token size if needed.
-	buf := make([]byte, 1024)
-	scanner.Buffer(buf, 10*1024*1024)
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		var parts []string
-		if strings.Contains(line, ":") {
-			parts = strings.Split(line, ":")
-		} else if strings.Contains(line, ";") {
-			parts = strings.Split(line, ";")
-		} else {
-			continue
+
+	// Check if the same email appears more than the allowed number of times
+	bySequence := newExternalSorter(s.tmpDir, s.sortMemory)
+	prevEmail, count := "", 0
+	err = forEachSorted(byEmail, func(rec sortRecord) error {
+		if rec.Key != prevEmail {
+			prevEmail, count = rec.Key, 0
 		}
-		if len(parts) < 2 {
-			continue
+		count++
+		if count > s.filter.cfg.MaxPerEmail {
+			return verdicts.Add(rec.Seq, s.filter.emailReasonParams(Reason{Code: "email_limit", Params: map[string]interface{}{
+				"occurrence":    count,
+				"max_per_email": s.filter.cfg.MaxPerEmail,
+			}}, rec.Value))
 		}
-		username := parts[0]
-		password := strings.TrimSpace(parts[1])
-		if priorWorkChecks(line, username, password, removedPriorWorks) {
-			*usernames = append(*usernames, username)
-			*passwords = append(*passwords, password)
+		if seqRec, numbered := sequenceRecord(rec.Key, rec.Seq); numbered {
+			return bySequence.Add(seqRec)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	return scanner.Err()
-}
 
-// processFile handles a single file: it runs rule-based cleaning,
-// writes the cleaned credentials to the destination file, and appends any removed entries to a log file.
-func processFile(srcPath, destPath string) error {
-	var usernames []string
-	var passwords []string
-	var removedPriorWorks []string
-	var removedRuleBased []string
-	var removedSuspiciousEmail []string
-	var removedFod []string
-	var removedFor []string
-	var removedFBOB []string
-
-	// Process the file and do previous work cleaning.
-	if err := priorWorksCleaning(srcPath, &usernames, &passwords, &removedPriorWorks); err != nil {
-		return err
+	// Check sequential username rule.
+	if err := checkSequences(bySequence, s.filter.cfg.SequenceLength, int64(s.filter.cfg.SequenceMaxGap), verdicts); err != nil {
+		return nil, err
 	}
+	return verdicts.Sort()
+}
 
-	// extra rule based
-	usernames, passwords = removeRuleBased(usernames, passwords, &removedRuleBased)
+// ruleBasedDatasetState applies the rules of ruleBasedFilter across every
+// file of a run, using dataset positions in place of line numbers.
+type ruleBasedDatasetState struct {
+	ruleBasedState
+}
 
-	// Call the suspicious emails cleaning function.
-	usernames, passwords = removeSuspiciousEmails(usernames, passwords, &removedSuspiciousEmail)
+func (s *ruleBasedDatasetState) Observe(file int, cred Credential) error {
+	return s.add(cred, datasetSeq(file, cred.LineNo))
+}
 
-	// Call remove follow on distribution cleaning
-	usernames, passwords = removeSuspiciousFollowOnDistribution(usernames, passwords, &removedFod)
+// CleaningStats stores counts of what each filter removed, or would remove in a dry run.
+type CleaningStats struct {
+	// inputLines counts every line read, totalProcessed those parsed as a credential.
+	inputLines     int64
+	totalProcessed int
+	kept           int
+	removals       map[string]int
+	// reasons counts removals by filter and reason code.
+	reasons map[string]map[string]int
+	// separated counts the kept credentials written to the separate output.
+	separated int
+	// unparsable counts the lines that are not credentials by the parser's reason.
+	unparsable map[string]int
+	// encoding is the encoding detected for a single file; encodingLines
+	// counts the lines decoded with each encoding.
+	encoding      string
+	encodingLines map[string]int64
+	// duration is the time spent cleaning.
+	duration time.Duration
+}
 
-	// Call remove follow on ratio cleaning
-	usernames, passwords, _ = removeSuspiciousFollowOnRatios(usernames, passwords, &removedFor)
+func newCleaningStats() CleaningStats {
+	return CleaningStats{
+		removals:      make(map[string]int),
+		reasons:       make(map[string]map[string]int),
+		unparsable:    make(map[string]int),
+		encodingLines: make(map[string]int64),
+	}
+}
 
-	// Call remove FBOB
-	usernames, passwords = removeFBOB(usernames, passwords, &removedFBOB)
+// remove counts a removal.
+func (s *CleaningStats) remove(filter, reason string) {
+	s.removals[filter]++
+	if s.reasons[filter] == nil {
+		s.reasons[filter] = make(map[string]int)
+	}
+	s.reasons[filter][reason]++
+}
 
-	// Write cleaned credentials to destination.
-	outFile, err := os.Create(destPath)
-	if err != nil {
-		return err
+// add accumulates other into s.
+func (s *CleaningStats) add(other CleaningStats) {
+	if s.removals == nil {
+		*s = newCleaningStats()
 	}
-	writer := bufio.NewWriter(outFile)
-	for i := range usernames {
-		if _, err := writer.WriteString(fmt.Sprintf("%s:%s\n", usernames[i], passwords[i])); err != nil {
-			outFile.Close()
-			return err
-		}
+	s.inputLines += other.inputLines
+	s.totalProcessed += other.totalProcessed
+	s.kept += other.kept
+	s.separated += other.separated
+	for name, count := range other.removals {
+		s.removals[name] += count
 	}
-	writer.Flush()
-	outFile.Close()
-
-	// add prior work removed to the log file.
-	if len(removedPriorWorks) > 0 {
-		f, err := os.OpenFile("/home/lucas/Data-Cleaning/CleanedBreach/removed_prior_work.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			return err
-		}
-		for _, entry := range removedPriorWorks {
-			if _, err := f.WriteString(entry + "\n"); err != nil {
-				f.Close()
-				return err
+	for name, counts := range other.reasons {
+		for reason, count := range counts {
+			if s.reasons[name] == nil {
+				s.reasons[name] = make(map[string]int)
 			}
+			s.reasons[name][reason] += count
 		}
-		f.Close()
 	}
+	for reason, count := range other.unparsable {
+		s.unparsable[reason] += count
+	}
+	for encoding, count := range other.encodingLines {
+		s.encodingLines[encoding] += count
+	}
+	s.duration += other.duration
+}
 
-	// Append removed rule based entries to the log file.
-	if len(removedRuleBased) > 0 {
-		f, err := os.OpenFile("/home/lucas/Data-Cleaning/CleanedBreach/removed_rule_based.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			return err
-		}
-		for _, entry := range removedRuleBased {
-			if _, err := f.WriteString(entry + "\n"); err != nil {
-				f.Close()
-				return err
-			}
-		}
-		f.Close()
+// cleaner runs a list of filters over every file of a directory tree.
+type cleaner struct {
+	filters []Filter
+	// dryRun reports what would be removed without writing cleaned data or removal logs.
+	dryRun bool
+	logDir string
+	// tmpDir holds the spools and sort runs of stateful filters.
+	tmpDir string
+	// sortMemory is how many bytes a single external sort may buffer in memory.
+	sortMemory int
+	// workers is how many files are cleaned at the same time.
+	workers int
+	// encoding is the input encoding, or encodingAuto to detect it per file.
+	encoding string
+	// compress gzips the cleaned files and the removal logs.
+	compress bool
+	// separateDir receives the credentials with non-ASCII characters when
+	// prior_work.non_ascii is "separate"; it is empty otherwise.
+	separateDir string
+	// dataset holds the verdicts of the dataset passes by filter name.
+	dataset map[string]*datasetVerdicts
+	// checkpoint records completed files; it is nil in a dry run.
+	checkpoint *checkpoint
+	// runID identifies the run in removals.jsonl.
+	runID string
+	// files holds the report of every committed file, in walk order.
+	files []statsReport
+	// datasetPassTime is how long the dataset passes took.
+	datasetPassTime time.Duration
+	stats           CleaningStats
+}
+
+// printStats prints how many entries each filter removed.
+func (c *cleaner) printStats(title string, stats CleaningStats) {
+	verb := "removed"
+	if c.dryRun {
+		verb = "would remove"
+	}
+	fmt.Printf("\n%s:\n", title)
+	fmt.Printf("Total entries processed: %d\n", stats.totalProcessed)
+	fmt.Printf("Unparsable lines: %d\n", stats.inputLines-int64(stats.totalProcessed))
+	for _, f := range c.filters {
+		count := stats.removals[f.Name()]
+		fmt.Printf("%s %s: %d (%.2f%%)\n", f.Name(), verb, count, percentage(count, stats.totalProcessed))
+	}
+	fmt.Printf("Entries kept: %d (%.2f%%)\n", stats.kept, percentage(stats.kept, stats.totalProcessed))
+	if c.separateDir != "" {
+		fmt.Printf("Non-ASCII entries kept separately: %d\n", stats.separated)
 	}
+}
 
-	// Append removed email based entries to the log file.
-	if len(removedSuspiciousEmail) > 0 {
-		f, err := os.OpenFile("/home/lucas/Data-Cleaning/CleanedBreach/removed_suspicious_email.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			return err
-		}
-		for _, entry := range removedSuspiciousEmail {
-			if _, err := f.WriteString(entry + "\n"); err != nil {
-				f.Close()
-				return err
-			}
-		}
-		f.Close()
+// Helper function to calculate percentage
+func percentage(count, total int) float64 {
+	if total == 0 {
+		return 0
 	}
+	return float64(count) * 100 / float64(total)
+}
 
-	// Append removed FOd entries to the log file.
-	if len(removedFod) > 0 {
-		f, err := os.OpenFile("/home/lucas/Data-Cleaning/CleanedBreach/removed_fod.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			return err
-		}
-		for _, entry := range removedFod {
-			if _, err := f.WriteString(entry + "\n"); err != nil {
-				f.Close()
-				return err
-			}
-		}
-		f.Close()
+// cleanOptions holds the paths and config overrides of a clean or count run,
+// as given on the command line.
+type cleanOptions struct {
+	srcDir, destDir, logDir string
+	// separateDir is where non-ASCII credentials go with prior_work.non_ascii "separate".
+	separateDir  string
+	configFile   string
+	filterList   string
+	forPasswords string
+	fodList      string
+	workers      int
+	// gzip compresses the output whatever the config says.
+	gzip bool
+	// report is the path, without extension, of the JSON and CSV run report.
+	report string
+	// resume continues the run recorded in the checkpoint of logDir.
+	resume bool
+}
+
+// cleanFlags registers the flags shared by the clean and count subcommands.
+func cleanFlags(fs *flag.FlagSet) *cleanOptions {
+	opts := &cleanOptions{}
+	fs.StringVar(&opts.srcDir, "src", "../../data", "directory containing the breach files to clean")
+	fs.StringVar(&opts.destDir, "dest", "../../CleanedBreach/data", "directory to write the cleaned files to")
+	fs.StringVar(&opts.logDir, "logs", "../../CleanedBreach", "directory to write the removed_<filter>.txt logs to")
+	fs.StringVar(&opts.separateDir, "separate-dest", "", "directory to write non-ASCII credentials to when prior_work.non_ascii is \"separate\" (unicode next to -dest when empty)")
+	fs.StringVar(&opts.configFile, "config", "", "pipeline config file (built-in defaults when empty)")
+	fs.StringVar(&opts.filterList, "filters", "", "comma separated list of filters to run, in order (overrides the config)")
+	fs.StringVar(&opts.forPasswords, "for-passwords", "", "suspicious passwords identified by identify-for (overrides the config)")
+	fs.StringVar(&opts.fodList, "fod-list", "", "reviewed follow-on distribution filter list (overrides the config)")
+	fs.IntVar(&opts.workers, "workers", 0, "number of files to clean in parallel (overrides the config)")
+	fs.BoolVar(&opts.gzip, "gzip", false, "write the cleaned files and removal logs gzip-compressed (overrides the config)")
+	fs.StringVar(&opts.report, "report", "", "path, without extension, of the JSON and CSV run report (<logs>/clean_report when empty)")
+	return opts
+}
+
+// runCleaner loads the config, builds the filters and cleans srcDir into destDir.
+func runCleaner(opts *cleanOptions, dryRun bool) error {
+	cfg, err := loadConfig(opts.configFile)
+	if err != nil {
+		return err
+	}
+	if opts.filterList != "" {
+		cfg.Filters = parseFilterList(opts.filterList)
+	}
+	if opts.forPasswords != "" {
+		cfg.FOR.PasswordsFile = opts.forPasswords
+	}
+	if opts.fodList != "" {
+		cfg.FOD.ListFile = opts.fodList
+	}
+	if opts.workers != 0 {
+		cfg.Engine.Workers = opts.workers
+	}
+	if opts.gzip {
+		cfg.Output.Gzip = true
+	}
+	if err := cfg.validate(); err != nil {
+		return err
 	}
 
-	// Append removed FOd entries to the log file.
-	if len(removedFor) > 0 {
-		f, err := os.OpenFile("/home/lucas/Data-Cleaning/CleanedBreach/removed_for.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			return err
-		}
-		for _, entry := range removedFor {
-			if _, err := f.WriteString(entry + "\n"); err != nil {
-				f.Close()
-				return err
-			}
+	filters, err := newFilters(cfg.Filters, cfg)
+	if err != nil {
+		return fmt.Errorf("error setting up filters: %v", err)
+	}
+	srcDir, destDir, logDir := opts.srcDir, opts.destDir, opts.logDir
+
+	c := &cleaner{
+		filters:    filters,
+		dryRun:     dryRun,
+		logDir:     logDir,
+		tmpDir:     cfg.Engine.TempDir,
+		sortMemory: cfg.Engine.SortMemoryMB << 20,
+		workers:    cfg.Engine.Workers,
+		encoding:   cfg.Input.Encoding,
+		compress:   cfg.Output.Gzip,
+		runID:      newRunID(),
+	}
+	if cfg.PriorWork.NonASCII == "separate" {
+		c.separateDir = opts.separateDir
+		if c.separateDir == "" {
+			c.separateDir = filepath.Join(filepath.Dir(filepath.Clean(destDir)), "unicode")
 		}
-		f.Close()
+		fmt.Println("Non-ASCII credentials are written to " + c.separateDir)
 	}
-
-	// Append removed FBOB entries to the log file
-	if len(removedFBOB) > 0 {
-		f, err := os.OpenFile("/home/lucas/Data-Cleaning/CleanedBreach/removed_FBOB.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if !dryRun {
+		hash, err := configHash(cfg)
 		if err != nil {
 			return err
 		}
-		for _, entry := range removedFBOB {
-			if _, err := f.WriteString(entry + "\n"); err != nil {
-				f.Close()
-				return err
-			}
+		logs := []string{removalsJSONL, unparsableLog}
+		for _, f := range filters {
+			logs = append(logs, removalLogName(f.Name()))
 		}
-		f.Close()
-	}
-	return nil
-}
-
-// recreateDirectoryStructure walks through srcDir, and for each file processes it individually.
-func recreateDirectoryStructure(srcDir, destDir string) error {
-	// Walk the source directory.
-	return filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+		for i, name := range logs {
+			logs[i] = compressedName(name, c.compress)
 		}
-		// Determine relative path.
-		relPath, err := filepath.Rel(srcDir, path)
-		if err != nil {
+		if c.checkpoint, err = openCheckpoint(logDir, c.runID, hash, logs, opts.resume); err != nil {
 			return err
 		}
-		destPath := filepath.Join(destDir, relPath)
-		// If directory, ensure it exists in destination.
-		if info.IsDir() {
-			return os.MkdirAll(destPath, os.ModePerm)
+		defer c.checkpoint.Close()
+		c.runID = c.checkpoint.runID
+		fmt.Println("Run ID: " + c.runID)
+	}
+	started := time.Now()
+	if err := c.recreateDirectoryStructure(srcDir, destDir); err != nil {
+		if c.checkpoint != nil {
+			fmt.Printf("Completed files are recorded in %s; rerun with -resume to continue.\n", filepath.Join(logDir, checkpointFile))
 		}
-		// Process individual file.
-		if err := processFile(path, destPath); err != nil {
-			return err
+		return fmt.Errorf("error processing directories: %v", err)
+	}
+	c.printStats("Totals for all files", c.stats)
+
+	report := runReport{
+		RunID:              c.runID,
+		DryRun:             dryRun,
+		Started:            started.UTC(),
+		Seconds:            time.Since(started).Seconds(),
+		DatasetPassSeconds: c.datasetPassTime.Seconds(),
+		Filters:            cfg.Filters,
+		Files:              c.files,
+		Total:              c.stats.report(""),
+	}
+	report.Total.Seconds = report.Seconds
+	reportPath := opts.report
+	if reportPath == "" {
+		reportPath = filepath.Join(logDir, "clean_report")
+	}
+	if err := writeReport(reportPath, report); err != nil {
+		return fmt.Errorf("error writing report: %v", err)
+	}
+	if c.checkpoint != nil {
+		if err := c.checkpoint.finish(); err != nil {
+			return fmt.Errorf("error finishing checkpoint: %v", err)
 		}
-		return nil
-	})
+	}
+	fmt.Println("Processing complete.")
+	return nil
 }
 
-func main() {
-	sourceDirectory := "/home/lucas/Data-Cleaning/data"
-	destinationDirectory := "/home/lucas/Data-Cleaning/CleanedBreach/data"
+// cmdClean implements the clean subcommand.
+func cmdClean(args []string) error {
+	fs := flag.NewFlagSet("clean", flag.ExitOnError)
+	opts := cleanFlags(fs)
+	dryRun := fs.Bool("dry-run", false, "count what would be removed without writing cleaned data or removal logs")
+	fs.BoolVar(&opts.resume, "resume", false, "continue an interrupted run from the checkpoint in the log directory")
+	fs.Parse(args)
 
-	if err := recreateDirectoryStructure(sourceDirectory, destinationDirectory); err != nil {
-		log.Fatalf("Error processing directories: %v", err)
-	}
-	fmt.Println("Processing complete.")
+	return runCleaner(opts, *dryRun)
+}
+
+// cmdCount implements the count subcommand, which is clean with -dry-run.
+func cmdCount(args []string) error {
+	fs := flag.NewFlagSet("count", flag.ExitOnError)
+	opts := cleanFlags(fs)
+	fs.Parse(args)
+
+	return runCleaner(opts, true)
 }
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"io"
+	"reflect"
+	"testing"
+)
+
+// sequenceVerdicts runs checkSequences over emails, the lines of an input in
+// order, and returns the positions of the emails it removes.
+func sequenceVerdicts(t *testing.T, emails []string, sequenceLength int, maxGap int64) []int64 {
+	t.Helper()
+	dir := t.TempDir()
+	bySequence := newExternalSorter(dir, 1<<20)
+	for i, email := range emails {
+		if rec, numbered := sequenceRecord(email, int64(i)); numbered {
+			if err := bySequence.Add(rec); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	verdicts := newVerdictSorter(dir, 1<<20)
+	if err := checkSequences(bySequence, sequenceLength, maxGap, verdicts); err != nil {
+		t.Fatal(err)
+	}
+	sorted, err := verdicts.Sort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sorted.Close()
+
+	var removed []int64
+	for {
+		v, err := sorted.Next()
+		if err == io.EOF {
+			return removed
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.Reason.Code != "sequential" {
+			t.Errorf("line %d removed for %q, want sequential", v.LineNo, v.Reason.Code)
+		}
+		removed = append(removed, v.LineNo)
+	}
+}
+
+func TestCheckSequences(t *testing.T) {
+	tests := []struct {
+		name   string
+		emails []string
+		length int
+		maxGap int64
+		want   []int64
+	}{
+		{
+			name:   "consecutive run",
+			emails: []string{"user1@x.com", "user2@x.com", "user3@x.com"},
+			length: 3, maxGap: 1,
+			want: []int64{0, 1, 2},
+		},
+		{
+			name:   "too short",
+			emails: []string{"user1@x.com", "user2@x.com"},
+			length: 3, maxGap: 1,
+		},
+		{
+			name:   "shuffled and interleaved",
+			emails: []string{"user3@x.com", "bob@x.com", "user1@x.com", "ann7@y.com", "user2@x.com"},
+			length: 3, maxGap: 1,
+			want: []int64{0, 2, 4},
+		},
+		{
+			name:   "gaps within max gap",
+			emails: []string{"user1@x.com", "user3@x.com", "user5@x.com"},
+			length: 3, maxGap: 2,
+			want: []int64{0, 1, 2},
+		},
+		{
+			name:   "gaps over max gap",
+			emails: []string{"user1@x.com", "user3@x.com", "user5@x.com"},
+			length: 3, maxGap: 1,
+		},
+		{
+			name:   "gap splits the run",
+			emails: []string{"user1@x.com", "user2@x.com", "user6@x.com", "user7@x.com"},
+			length: 3, maxGap: 2,
+		},
+		{
+			name:   "only the long run of a base name",
+			emails: []string{"user1@x.com", "user2@x.com", "user3@x.com", "user10@x.com", "user11@x.com"},
+			length: 3, maxGap: 2,
+			want: []int64{0, 1, 2},
+		},
+		{
+			name:   "zero padding",
+			emails: []string{"user007@x.com", "user8@x.com", "user09@x.com"},
+			length: 3, maxGap: 1,
+			want: []int64{0, 1, 2},
+		},
+		{
+			name:   "duplicates are not distinct numbers",
+			emails: []string{"user1@x.com", "user1@x.com", "user2@x.com"},
+			length: 3, maxGap: 1,
+		},
+		{
+			name:   "duplicates of a long run are removed",
+			emails: []string{"user1@x.com", "user2@x.com", "user2@x.com", "user3@x.com"},
+			length: 3, maxGap: 1,
+			want: []int64{0, 1, 2, 3},
+		},
+		{
+			name:   "whole run once long enough",
+			emails: []string{"user5@x.com", "user4@x.com", "user3@x.com", "user2@x.com", "user1@x.com"},
+			length: 3, maxGap: 1,
+			want: []int64{0, 1, 2, 3, 4},
+		},
+		{
+			name:   "other domain is another run",
+			emails: []string{"user1@x.com", "user2@y.com", "user3@x.com"},
+			length: 3, maxGap: 1,
+		},
+		{
+			name:   "other base name is another run",
+			emails: []string{"user1@x.com", "usr2@x.com", "user3@x.com"},
+			length: 3, maxGap: 2,
+		},
+		{
+			name:   "unnumbered usernames",
+			emails: []string{"user@x.com", "user1", "1@x.com"},
+			length: 2, maxGap: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		got := sequenceVerdicts(t, tt.emails, tt.length, tt.maxGap)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: removed lines %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
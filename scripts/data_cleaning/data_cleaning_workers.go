@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// errWalkStopped ends the walk after a file failed to clean.
+var errWalkStopped = errors.New("walk stopped")
+
+// fileJob is one file of the source tree waiting to be cleaned.
+type fileJob struct {
+	// index is the position of the file in walk order.
+	index    int
+	src      sourceFile
+	relPath  string
+	destPath string
+	// separatePath receives the non-ASCII credentials; it is empty unless they are kept separately.
+	separatePath string
+	// hash is the SHA-256 of the input, recorded in the checkpoint.
+	hash string
+	// resumed is set for a file a resumed run already completed; its
+	// statistics come from the checkpoint.
+	resumed bool
+	// logDir holds this file's removal logs until they are committed.
+	logDir string
+	stats  CleaningStats
+	err    error
+	done   chan struct{}
+}
+
+// recreateDirectoryStructure walks through srcDir, and for each file processes it individually.
+// Archives are walked as directories of their members, as walkSources does.
+// Files are cleaned by c.workers goroutines, but their statistics and removal
+// logs are committed in walk order, so the output is the same as a serial run.
+func (c *cleaner) recreateDirectoryStructure(srcDir, destDir string) error {
+	queue := make(chan *fileJob, c.workers)
+	ordered := make(chan *fileJob, c.workers)
+	stop := make(chan struct{})
+	walkErr := make(chan error, 1)
+
+	workDir, err := os.MkdirTemp(c.tmpDir, "logs-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+
+	passStart := time.Now()
+	if err := c.datasetPass(srcDir, workDir); err != nil {
+		return err
+	}
+	c.datasetPassTime = time.Since(passStart)
+
+	// Walk the source directory and hand out the files in order.
+	go func() {
+		defer close(queue)
+		defer close(ordered)
+		index := 0
+		walkErr <- walkSources(srcDir, func(src sourceFile) error {
+			relPath := src.relPath
+			// Compressed inputs are written uncompressed unless the output is compressed.
+			outPath := relPath
+			if !src.isDir {
+				outPath = compressedName(trimCompressionExt(relPath), c.compress)
+			}
+			destPath := filepath.Join(destDir, outPath)
+			var separatePath string
+			if c.separateDir != "" {
+				separatePath = filepath.Join(c.separateDir, outPath)
+			}
+			// If directory, ensure it exists in destination.
+			if src.isDir {
+				if c.dryRun {
+					return nil
+				}
+				if separatePath != "" {
+					if err := os.MkdirAll(separatePath, os.ModePerm); err != nil {
+						return err
+					}
+				}
+				return os.MkdirAll(destPath, os.ModePerm)
+			}
+			job := &fileJob{index: index, src: src, relPath: filepath.ToSlash(relPath), destPath: destPath, separatePath: separatePath, done: make(chan struct{})}
+			index++
+			if c.checkpoint != nil {
+				if entry, done := c.checkpoint.done[job.relPath]; done {
+					job.resumed, job.hash, job.stats = true, entry.SHA256, entry.Stats.stats()
+				}
+			}
+			var err error
+			if job.logDir, err = os.MkdirTemp(workDir, "file-*"); err != nil {
+				return err
+			}
+			select {
+			case ordered <- job:
+			case <-stop:
+				return errWalkStopped
+			}
+			queue <- job
+			return nil
+		})
+	}()
+
+	for i := 0; i < c.workers; i++ {
+		go func() {
+			for job := range queue {
+				select {
+				case <-stop:
+				default:
+					job.err = c.runJob(job)
+				}
+				close(job.done)
+			}
+		}()
+	}
+
+	// Commit finished files in walk order, stopping at the first failure.
+	var firstErr error
+	for job := range ordered {
+		<-job.done
+		if firstErr == nil {
+			firstErr = job.err
+			if firstErr == nil {
+				firstErr = c.commit(job)
+			}
+			if firstErr != nil {
+				close(stop)
+			}
+		}
+		os.RemoveAll(job.logDir)
+	}
+	if err := <-walkErr; firstErr == nil && err != errWalkStopped {
+		firstErr = err
+	}
+	return firstErr
+}
+
+// runJob cleans one file, or checks that a file completed by an earlier run is unchanged.
+func (c *cleaner) runJob(job *fileJob) error {
+	if c.checkpoint == nil {
+		var err error
+		job.stats, err = c.processFile(job.index, job.src, job.destPath, job.separatePath, job.logDir)
+		return err
+	}
+
+	hash, err := hashFile(job.src)
+	if err != nil {
+		return err
+	}
+	if job.resumed {
+		if hash != job.hash {
+			return fmt.Errorf("%s changed since it was cleaned; remove %s and the removal logs to start over", job.src.path, checkpointFile)
+		}
+		return nil
+	}
+	job.hash = hash
+	job.stats, err = c.processFile(job.index, job.src, job.destPath, job.separatePath, job.logDir)
+	return err
+}
+
+// commit appends a cleaned file's removal logs to the shared logs, records it
+// in the checkpoint and adds its statistics.
+func (c *cleaner) commit(job *fileJob) error {
+	if job.resumed {
+		fmt.Println("Already cleaned: " + job.src.path)
+	} else if !c.dryRun {
+		if err := appendLogs(job.logDir, c.logDir); err != nil {
+			return err
+		}
+		if c.checkpoint != nil {
+			if err := c.checkpoint.record(job.relPath, job.hash, job.stats); err != nil {
+				return err
+			}
+		}
+	}
+	c.stats.add(job.stats)
+	c.files = append(c.files, job.stats.report(job.relPath))
+	c.printStats("File statistics for "+filepath.Base(job.src.path), job.stats)
+	return nil
+}
+
+// appendLogs appends every log file in srcDir to the file of the same name in destDir.
+func appendLogs(srcDir, destDir string) error {
+	entries, err := os.ReadDir(srcDir)
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	for _, entry := range entries {
+		if err := appendFile(filepath.Join(srcDir, entry.Name()), filepath.Join(destDir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendFile appends the contents of src to dest, creating dest if needed.
+func appendFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
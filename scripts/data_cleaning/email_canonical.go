@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+)
+
+// emailProvider describes how a mail provider reads the addresses it hosts.
+type emailProvider struct {
+	// domain is the domain every alias of the provider is rewritten to.
+	domain string
+	// plusTags is set when user+tag@domain delivers to user@domain.
+	plusTags bool
+	// dots is what a "." in the local part is the same as: "" when dots are
+	// ignored, "-" when they are interchangeable with hyphens, and "." when
+	// they matter.
+	dots string
+}
+
+// emailProviders maps the domains of providers with aliasing rules to their rules.
+var emailProviders = map[string]emailProvider{
+	"gmail.com":      {domain: "gmail.com", plusTags: true, dots: ""},
+	"googlemail.com": {domain: "gmail.com", plusTags: true, dots: ""},
+	"outlook.com":    {domain: "outlook.com", plusTags: true, dots: "."},
+	"hotmail.com":    {domain: "hotmail.com", plusTags: true, dots: "."},
+	"live.com":       {domain: "live.com", plusTags: true, dots: "."},
+	"yandex.ru":      {domain: "yandex.ru", plusTags: true, dots: "-"},
+	"yandex.com":     {domain: "yandex.ru", plusTags: true, dots: "-"},
+	"yandex.by":      {domain: "yandex.ru", plusTags: true, dots: "-"},
+	"yandex.kz":      {domain: "yandex.ru", plusTags: true, dots: "-"},
+	"yandex.ua":      {domain: "yandex.ru", plusTags: true, dots: "-"},
+	"ya.ru":          {domain: "yandex.ru", plusTags: true, dots: "-"},
+}
+
+// canonicalEmail returns the form of an email address that is the same for
+// every spelling of one mailbox: lower case, with the domain aliases, plus
+// tags and dots of emailProviders resolved, so "John.Doe@Gmail.com" and
+// "johndoe+x@googlemail.com" both become "johndoe@gmail.com". Usernames
+// that are not email addresses are returned unchanged.
+func canonicalEmail(email string) string {
+	at := strings.LastIndexByte(email, '@')
+	if at < 0 {
+		return email
+	}
+	local, domain := strings.ToLower(email[:at]), strings.ToLower(email[at+1:])
+	provider, known := emailProviders[domain]
+	if !known {
+		return local + "@" + domain
+	}
+	if provider.plusTags {
+		if plus := strings.IndexByte(local, '+'); plus > 0 {
+			local = local[:plus]
+		}
+	}
+	if provider.dots != "." {
+		local = strings.ReplaceAll(local, ".", provider.dots)
+	}
+	return local + "@" + provider.domain
+}
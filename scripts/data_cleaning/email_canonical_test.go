@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestCanonicalEmail(t *testing.T) {
+	tests := []struct {
+		email string
+		want  string
+	}{
+		{"John.Doe@Gmail.com", "johndoe@gmail.com"},
+		{"johndoe@gmail.com", "johndoe@gmail.com"},
+		{"johndoe+x@googlemail.com", "johndoe@gmail.com"},
+		{"j.o.h.n.d.o.e+a+b@GMAIL.COM", "johndoe@gmail.com"},
+		// A plus tag needs a mailbox in front of it.
+		{"+x@gmail.com", "+x@gmail.com"},
+		{"John.Doe+news@Outlook.com", "john.doe@outlook.com"},
+		{"john.doe+x@hotmail.com", "john.doe@hotmail.com"},
+		{"john.doe+x@live.com", "john.doe@live.com"},
+		{"ivan.petrov@yandex.ru", "ivan-petrov@yandex.ru"},
+		{"Ivan.Petrov+x@Yandex.com", "ivan-petrov@yandex.ru"},
+		{"ivan-petrov@yandex.by", "ivan-petrov@yandex.ru"},
+		{"ivan.petrov@yandex.kz", "ivan-petrov@yandex.ru"},
+		{"ivan.petrov@yandex.ua", "ivan-petrov@yandex.ru"},
+		{"ivan.petrov@ya.ru", "ivan-petrov@yandex.ru"},
+		// Other providers keep dots and plus tags.
+		{"John.Doe+x@Web.de", "john.doe+x@web.de"},
+		{"john@sub.gmail.com", "john@sub.gmail.com"},
+		// The domain follows the last "@".
+		{"a@b@Gmail.com", "a@b@gmail.com"},
+		{"JohnDoe", "JohnDoe"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := canonicalEmail(tt.email); got != tt.want {
+			t.Errorf("canonicalEmail(%q) = %q, want %q", tt.email, got, tt.want)
+		}
+	}
+}
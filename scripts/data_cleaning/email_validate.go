@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// embeddedTLDs is the top-level domain list used when rule_based.tld_file is
+// not set; see the header of tlds.txt for how to update it.
+//
+//go:embed tlds.txt
+var embeddedTLDs string
+
+// Length limits of RFC 5321, in bytes of the ASCII form of a domain.
+const (
+	maxLocalPartLength = 64
+	maxDomainLength    = 253
+	maxLabelLength     = 63
+)
+
+// punycodePrefix marks a domain label holding the Punycode form of an IDN label.
+const punycodePrefix = "xn--"
+
+// localPartSpecials are the characters besides letters and digits an unquoted
+// local part may hold (RFC 5322 atext).
+const localPartSpecials = "!#$%&'*+-/=?^_`{|}~"
+
+// emailValidator checks the syntax of email addresses and that their domain
+// ends in a known top-level domain. It is built once per run.
+type emailValidator struct {
+	// tlds holds the known top-level domains, in lower case and ASCII form.
+	tlds map[string]bool
+}
+
+// newEmailValidator returns a validator accepting the top-level domains listed
+// in tldFile, or in the embedded list if tldFile is empty.
+func newEmailValidator(tldFile string) (*emailValidator, error) {
+	var r io.Reader = strings.NewReader(embeddedTLDs)
+	name := "embedded TLD list"
+	if tldFile != "" {
+		file, err := os.Open(tldFile)
+		if err != nil {
+			return nil, fmt.Errorf("error opening TLD list: %v", err)
+		}
+		defer file.Close()
+		r, name = file, tldFile
+	}
+	tlds, err := parseTLDList(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if len(tlds) == 0 {
+		return nil, fmt.Errorf("%s: no top-level domains", name)
+	}
+	return &emailValidator{tlds: tlds}, nil
+}
+
+// parseTLDList reads a list in the format of the IANA list: one domain per
+// line, with # comments. Unicode domains are stored in their xn-- form.
+func parseTLDList(r io.Reader) (map[string]bool, error) {
+	tlds := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		label, problem := asciiLabel(line)
+		if problem != "" {
+			return nil, fmt.Errorf("line %d: invalid top-level domain %q (%s)", lineNo, line, strings.ReplaceAll(problem, "_", " "))
+		}
+		tlds[label] = true
+	}
+	return tlds, scanner.Err()
+}
+
+// check returns why email is not a valid address, and false if it is. Each
+// kind of failure has its own reason code:
+//
+//	email_missing_at   no "@"
+//	email_multiple_at  more than one "@"
+//	email_local_part   the part before the "@" is empty, too long, has a
+//	                   character outside letters, digits and RFC 5322 atext,
+//	                   or a leading, trailing or doubled dot
+//	email_domain       the domain is too long, has a single label or a label
+//	                   that is empty, too long, has an invalid character or
+//	                   starts or ends with a hyphen
+//	email_punycode     an xn-- label is not valid Punycode, or a Unicode
+//	                   label cannot be encoded
+//	email_tld          the top-level domain is not in the list
+//
+// Unicode local parts and domains are accepted (RFC 6531 and IDNA); domains
+// are checked in their ASCII form.
+func (v *emailValidator) check(email string) (Reason, bool) {
+	at := strings.Count(email, "@")
+	switch {
+	case at == 0:
+		return Reason{Code: "email_missing_at"}, true
+	case at > 1:
+		return Reason{Code: "email_multiple_at", Params: map[string]interface{}{"count": at}}, true
+	}
+	local, domain := splitEmail(email)
+
+	if problem := localPartProblem(local); problem != "" {
+		return Reason{Code: "email_local_part", Params: map[string]interface{}{"problem": problem}}, true
+	}
+
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return Reason{Code: "email_domain", Params: map[string]interface{}{"problem": "single_label"}}, true
+	}
+	length := len(labels) - 1
+	for i, label := range labels {
+		ascii, problem := asciiLabel(label)
+		switch problem {
+		case "":
+		case "punycode":
+			return Reason{Code: "email_punycode", Params: map[string]interface{}{"label": label}}, true
+		default:
+			return Reason{Code: "email_domain", Params: map[string]interface{}{"problem": problem, "label": label}}, true
+		}
+		labels[i] = ascii
+		length += len(ascii)
+	}
+	if length > maxDomainLength {
+		return Reason{Code: "email_domain", Params: map[string]interface{}{
+			"problem": "too_long",
+			"length":  length,
+			"max":     maxDomainLength,
+		}}, true
+	}
+
+	if tld := labels[len(labels)-1]; !v.tlds[tld] {
+		return Reason{Code: "email_tld", Params: map[string]interface{}{"tld": tld}}, true
+	}
+	return Reason{}, false
+}
+
+// splitEmail splits an email at its last "@".
+func splitEmail(email string) (local, domain string) {
+	at := strings.LastIndexByte(email, '@')
+	return email[:at], email[at+1:]
+}
+
+// localPartProblem returns what is wrong with the local part of an address,
+// or "" if nothing is.
+func localPartProblem(local string) string {
+	switch {
+	case local == "":
+		return "empty"
+	case len(local) > maxLocalPartLength:
+		return "too_long"
+	case strings.HasPrefix(local, ".") || strings.HasSuffix(local, "."):
+		return "leading_or_trailing_dot"
+	case strings.Contains(local, ".."):
+		return "consecutive_dots"
+	}
+	for _, r := range local {
+		if r == '.' || r < utf8.RuneSelf && strings.ContainsRune(localPartSpecials, r) {
+			continue
+		}
+		if r == utf8.RuneError || !(unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)) {
+			return "invalid_character"
+		}
+	}
+	return ""
+}
+
+// asciiLabel returns the lower case ASCII form of a domain label, encoding
+// Unicode labels as Punycode, and what is wrong with the label, "" if
+// nothing. An xn-- label must decode to a Unicode label it is the canonical
+// encoding of.
+func asciiLabel(label string) (string, string) {
+	if label == "" {
+		return "", "empty_label"
+	}
+	label = strings.ToLower(label)
+	if !isASCII(label) {
+		for _, r := range label {
+			if r != '-' && (r == utf8.RuneError || !(unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r))) {
+				return "", "invalid_character"
+			}
+		}
+		encoded, err := punycodeEncode(label)
+		if err != nil {
+			return "", "punycode"
+		}
+		label = punycodePrefix + encoded
+	} else {
+		for i := 0; i < len(label); i++ {
+			if c := label[i]; !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+				return "", "invalid_character"
+			}
+		}
+		if strings.HasPrefix(label, punycodePrefix) {
+			decoded, err := punycodeDecode(label[len(punycodePrefix):])
+			if err != nil || isASCII(decoded) {
+				return "", "punycode"
+			}
+			if encoded, err := punycodeEncode(decoded); err != nil || punycodePrefix+encoded != label {
+				return "", "punycode"
+			}
+		} else if len(label) >= 4 && label[2:4] == "--" {
+			// Hyphens in the third and fourth positions are reserved for
+			// encodings such as xn-- (RFC 5891).
+			return "", "reserved_hyphens"
+		}
+	}
+	switch {
+	case len(label) > maxLabelLength:
+		return "", "label_too_long"
+	case strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-"):
+		return "", "leading_or_trailing_hyphen"
+	}
+	return label, ""
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEmailValidatorCheck(t *testing.T) {
+	v, err := newEmailValidator("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		email string
+		// code is the reason code, "" for a valid address.
+		code string
+		// problem is the "problem" parameter of the reason, if it has one.
+		problem string
+	}{
+		{"bob@example.com", "", ""},
+		{"Bob.Smith+tag@Mail.Example.DE", "", ""},
+		{"o'neil!#$%&*/=?^_`{|}~-@example.org", "", ""},
+		{"müller@bücher.de", "", ""},
+		{"bob@xn--bcher-kva.de", "", ""},
+		{"ivan@пример.рф", "", ""},
+		{"bob@xn--p1ai.xn--p1ai", "", ""},
+		{"bob@a-b.co.uk", "", ""},
+
+		{"bob.example.com", "email_missing_at", ""},
+		{"bob@a@example.com", "email_multiple_at", ""},
+
+		{"@example.com", "email_local_part", "empty"},
+		{strings.Repeat("a", 65) + "@example.com", "email_local_part", "too_long"},
+		{".bob@example.com", "email_local_part", "leading_or_trailing_dot"},
+		{"bob.@example.com", "email_local_part", "leading_or_trailing_dot"},
+		{"bo..b@example.com", "email_local_part", "consecutive_dots"},
+		{"bo b@example.com", "email_local_part", "invalid_character"},
+		{"bo\"b@example.com", "email_local_part", "invalid_character"},
+		{"bo�b@example.com", "email_local_part", "invalid_character"},
+
+		{"bob@localhost", "email_domain", "single_label"},
+		{"bob@", "email_domain", "single_label"},
+		{"bob@example..com", "email_domain", "empty_label"},
+		{"bob@.example.com", "email_domain", "empty_label"},
+		{"bob@exa_mple.com", "email_domain", "invalid_character"},
+		{"bob@-example.com", "email_domain", "leading_or_trailing_hyphen"},
+		{"bob@example-.com", "email_domain", "leading_or_trailing_hyphen"},
+		{"bob@ab--cd.com", "email_domain", "reserved_hyphens"},
+		{"bob@" + strings.Repeat("a", 64) + ".com", "email_domain", "label_too_long"},
+		{"bob@" + strings.Repeat(strings.Repeat("a", 63)+".", 4) + "com", "email_domain", "too_long"},
+
+		{"bob@xn--.com", "email_punycode", ""},
+		// An xn-- label must hold a non-ASCII label.
+		{"bob@xn--abc-.com", "email_punycode", ""},
+		{"bob@xn--99999999999.com", "email_punycode", ""},
+		// xn-- labels are read in lower case.
+		{"bob@xn--Bcher-kva.de", "", ""},
+		{"bob@xn--bcher-KVA.de", "", ""},
+
+		{"bob@example.invalidtld", "email_tld", ""},
+		{"bob@example.onion", "email_tld", ""},
+		{"bob@example.c0m", "email_tld", ""},
+	}
+
+	for _, tt := range tests {
+		reason, invalid := v.check(tt.email)
+		if invalid != (tt.code != "") || reason.Code != tt.code {
+			t.Errorf("check(%q) = %q, %v, want %q", tt.email, reason.Code, invalid, tt.code)
+			continue
+		}
+		if tt.problem != "" && reason.Params["problem"] != tt.problem {
+			t.Errorf("check(%q) problem = %v, want %q", tt.email, reason.Params["problem"], tt.problem)
+		}
+	}
+}
+
+func TestParseTLDList(t *testing.T) {
+	tlds, err := parseTLDList(strings.NewReader("# Version 1\nCOM\n\n  de  \nXN--P1AI\nрф\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tld := range []string{"com", "de", "xn--p1ai"} {
+		if !tlds[tld] {
+			t.Errorf("%s is missing from %v", tld, tlds)
+		}
+	}
+	if len(tlds) != 3 {
+		t.Errorf("got %d top-level domains %v, want 3", len(tlds), tlds)
+	}
+
+	if _, err := parseTLDList(strings.NewReader("com\nnot a tld\n")); err == nil {
+		t.Error("parseTLDList accepted a line with spaces")
+	}
+}
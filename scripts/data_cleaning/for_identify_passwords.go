@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"os"
 )
@@ -13,18 +14,11 @@ type PrefixRecord struct {
 	FollowingCount  float64 `json:"following_count"`
 }
 
-// calcCurve computes the threshold for a given standalone count
-// and returns true if the followup count is less than the threshold.
-func calcCurve(standalone, followup float64) bool {
-	var threshold float64
-	switch {
-	case standalone >= 3000 && standalone <= 5000:
-		threshold = 1
-	case standalone > 5000 && standalone <= 20000:
-		threshold = (standalone / 500) - 10
-	case standalone > 20000:
-		threshold = (standalone / 120) - 135
-	default:
+// calcCurve computes the threshold for a given standalone count from the configured
+// curve and returns true if the followup count is less than the threshold.
+func calcCurve(curve FORConfig, standalone, followup float64) bool {
+	threshold, covered := curve.threshold(standalone)
+	if !covered {
 		return false
 	}
 	return followup < threshold
@@ -32,9 +26,9 @@ func calcCurve(standalone, followup float64) bool {
 
 // identifySuspiciousPasswords processes the prefix statistics and identifies passwords
 // with suspicious follow-on ratios.
-func identifySuspiciousPasswords() (map[string]bool, error) {
+func identifySuspiciousPasswords(statsFile string, curve FORConfig) (map[string]bool, error) {
 	// Open and load JSON data
-	file, err := os.Open("./data_cleaning/prefix_statistics.json")
+	file, err := os.Open(statsFile)
 	if err != nil {
 		return nil, err
 	}
@@ -54,7 +48,7 @@ func identifySuspiciousPasswords() (map[string]bool, error) {
 	// Identify suspicious passwords
 	suspiciousPasswords := make(map[string]bool)
 	for _, record := range prefixRecords {
-		if calcCurve(record.StandaloneCount, record.FollowingCount) {
+		if calcCurve(curve, record.StandaloneCount, record.FollowingCount) {
 			suspiciousPasswords[record.Prefix] = true
 		}
 	}
@@ -62,12 +56,29 @@ func identifySuspiciousPasswords() (map[string]bool, error) {
 	return suspiciousPasswords, nil
 }
 
-func main() {
+// cmdIdentifyFor implements the identify-for subcommand.
+func cmdIdentifyFor(args []string) error {
+	fs := flag.NewFlagSet("identify-for", flag.ExitOnError)
+	configFile := configFlag(fs)
+	statsFile := fs.String("in", "prefix_statistics.json", "prefix statistics written by ratio-stats")
+	outputPath := fs.String("out", "", "file to write the suspicious passwords to (defaults to the config's for.passwords_file)")
+	fs.Parse(args)
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	if *outputPath == "" {
+		*outputPath = cfg.FOR.PasswordsFile
+	}
+	if *outputPath == "" {
+		return fmt.Errorf("no output file: set -out or the config's for.passwords_file")
+	}
+
 	// Identify suspicious passwords
-	suspiciousPasswords, err := identifySuspiciousPasswords()
+	suspiciousPasswords, err := identifySuspiciousPasswords(*statsFile, cfg.FOR)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error identifying suspicious passwords: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("error identifying suspicious passwords: %v", err)
 	}
 
 	// Convert map to slice for JSON output
@@ -77,19 +88,18 @@ func main() {
 	}
 
 	// Write suspicious passwords to output file
-	outputFile, err := os.Create("./data_cleaning/for_passwords_identified.json")
+	outputFile, err := os.Create(*outputPath)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating output file: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("error creating output file: %v", err)
 	}
 	defer outputFile.Close()
 
 	encoder := json.NewEncoder(outputFile)
 	encoder.SetIndent("", "  ")
 	if err := encoder.Encode(passwordsList); err != nil {
-		fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("error writing output: %v", err)
 	}
 
-	fmt.Printf("Found %d suspicious passwords. Results written to for_passwords_identified.json\n", len(passwordsList))
+	fmt.Printf("Found %d suspicious passwords. Results written to %s\n", len(passwordsList), *outputPath)
+	return nil
 }
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Input encodings. encodingAuto detects the encoding of every file.
+const (
+	encodingAuto        = "auto"
+	encodingUTF8        = "utf-8"
+	encodingLatin1      = "latin-1"
+	encodingWindows1251 = "windows-1251"
+	encodingUTF16LE     = "utf-16le"
+	encodingUTF16BE     = "utf-16be"
+)
+
+// inputEncodings are the values input.encoding accepts.
+var inputEncodings = []string{encodingAuto, encodingUTF8, encodingLatin1, encodingWindows1251, encodingUTF16LE, encodingUTF16BE}
+
+// encodingSample is how many bytes of a file detectEncoding looks at.
+const encodingSample = 64 << 10
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// legacyCharmaps are the single byte encodings a line may be decoded with.
+var legacyCharmaps = map[string]*charmap.Charmap{
+	encodingLatin1:      charmap.ISO8859_1,
+	encodingWindows1251: charmap.Windows1251,
+}
+
+// detectEncoding returns the encoding of a file from its first bytes, and the
+// length of its byte order mark. A byte order mark decides; otherwise a sample
+// that is valid UTF-8 is UTF-8, and anything else is Latin-1 or Windows-1251
+// as detectLegacyEncoding decides.
+func detectEncoding(sample []byte) (encoding string, bom int) {
+	switch {
+	case bytes.HasPrefix(sample, bomUTF8):
+		return encodingUTF8, len(bomUTF8)
+	case bytes.HasPrefix(sample, bomUTF16LE):
+		return encodingUTF16LE, len(bomUTF16LE)
+	case bytes.HasPrefix(sample, bomUTF16BE):
+		return encodingUTF16BE, len(bomUTF16BE)
+	}
+	if validUTF8Prefix(sample) {
+		return encodingUTF8, 0
+	}
+	return detectLegacyEncoding(sample), 0
+}
+
+// validUTF8Prefix reports whether sample is valid UTF-8, allowing the last
+// character to be cut off by the end of the sample.
+func validUTF8Prefix(sample []byte) bool {
+	for len(sample) > 0 {
+		r, size := utf8.DecodeRune(sample)
+		if r == utf8.RuneError && size == 1 {
+			return !utf8.FullRune(sample)
+		}
+		sample = sample[size:]
+	}
+	return true
+}
+
+// minCyrillicLetters is how many letters of Cyrillic words a sample needs
+// before detectLegacyEncoding takes it for Windows-1251.
+const minCyrillicLetters = 4
+
+// cyrillicVowels are the lower case Cyrillic vowels in Windows-1251.
+const cyrillicVowels = "\xe0\xe5\xe8\xee\xf3\xfb\xfd\xfe\xff"
+
+// detectLegacyEncoding tells Latin-1 from Windows-1251. Both put letters in
+// 0xC0-0xFF, but Latin-1 text uses them for accented letters inside Latin
+// words ("müller") while Cyrillic words consist of them entirely ("пароль").
+// The letters of a word count for Windows-1251 when the word reads as
+// Cyrillic, and for Latin-1 otherwise. Windows-1251 needs clearly more
+// evidence; anything else, including pure ASCII, is Latin-1.
+func detectLegacyEncoding(sample []byte) string {
+	var cyrillic, latin int
+	var word []byte
+	ascii := false
+	end := func() {
+		switch {
+		case ascii:
+			latin += len(word)
+		case len(word) >= 2 && cyrillicWord(word):
+			cyrillic += len(word)
+		case len(word) >= 2:
+			latin += len(word)
+		}
+		word, ascii = word[:0], false
+	}
+	for _, b := range sample {
+		switch {
+		case b >= 0xC0:
+			word = append(word, b)
+		case 'a' <= b|0x20 && b|0x20 <= 'z':
+			ascii = true
+		default:
+			end()
+		}
+	}
+	end()
+	if cyrillic >= minCyrillicLetters && cyrillic > 2*latin {
+		return encodingWindows1251
+	}
+	return encodingLatin1
+}
+
+// cyrillicWord reports whether a word of two or more bytes in 0xC0-0xFF reads
+// as Cyrillic in Windows-1251: lower case, upper case or capitalized, and
+// with a vowel unless it is shorter than three letters.
+func cyrillicWord(word []byte) bool {
+	lower := 0
+	for _, b := range word[1:] {
+		if b >= 0xE0 {
+			lower++
+		}
+	}
+	if lower != 0 && lower != len(word)-1 {
+		return false
+	}
+	if lower == 0 && word[0] >= 0xE0 {
+		return false
+	}
+	if len(word) < 3 {
+		return true
+	}
+	for _, b := range word {
+		if strings.IndexByte(cyrillicVowels, b|0x20) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// invalidUTF8Lines returns the lines of sample that are not valid UTF-8.
+func invalidUTF8Lines(sample []byte) []byte {
+	var invalid []byte
+	for _, line := range bytes.SplitAfter(sample, []byte("\n")) {
+		if !utf8.Valid(line) {
+			invalid = append(invalid, line...)
+		}
+	}
+	return invalid
+}
+
+// lineReader reads the lines of a breach file as UTF-8.
+//
+// With a fixed encoding every line is decoded with it. With encodingAuto the
+// encoding of the file is detected from its first bytes. UTF-16 files are
+// decoded as a whole; in any other file each line that is valid UTF-8 is read
+// as UTF-8 and every other line with the Latin-1 or Windows-1251 decoding
+// detected for the file, as dumps often mix lines of different sources.
+type lineReader struct {
+	file    io.Closer
+	scanner *bufio.Scanner
+	// encoding is the encoding of the file, detected or configured.
+	encoding string
+	// perLine is set when lines are decoded one by one: fallback decodes the
+	// lines that are not valid UTF-8, or all lines when utf8 is false.
+	perLine  bool
+	utf8     bool
+	fallback string
+	decoder  *encoding.Decoder
+	text     string
+	// lines counts the lines read by the encoding they were decoded with.
+	lines map[string]int64
+}
+
+// openLineReader opens a file for reading its lines in the given encoding,
+// which is one of inputEncodings. Gzip and bzip2 files are decompressed.
+func openLineReader(path, enc string) (*lineReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return newLineReader(path, f, enc)
+}
+
+// newLineReader reads the lines of f, which is named name, as openLineReader
+// does. The lineReader closes f.
+func newLineReader(name string, f io.ReadCloser, enc string) (*lineReader, error) {
+	in, _, err := openDecompressed(f, name)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	br := bufio.NewReaderSize(in, encodingSample)
+	sample, err := br.Peek(encodingSample)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		f.Close()
+		return nil, err
+	}
+
+	r := &lineReader{file: f, encoding: enc, lines: make(map[string]int64)}
+	detected, bom := detectEncoding(sample)
+	if enc == encodingAuto {
+		r.encoding = detected
+	} else if detected != r.encoding {
+		// Only drop a byte order mark that belongs to the configured encoding.
+		bom = 0
+	}
+	br.Discard(bom)
+
+	var reader io.Reader = br
+	switch r.encoding {
+	case encodingUTF16LE:
+		reader = unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM).NewDecoder().Reader(br)
+	case encodingUTF16BE:
+		reader = unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM).NewDecoder().Reader(br)
+	case encodingUTF8:
+		r.perLine, r.utf8 = true, true
+		if enc == encodingAuto {
+			r.fallback = detectLegacyEncoding(invalidUTF8Lines(sample))
+		}
+	case encodingLatin1, encodingWindows1251:
+		r.perLine, r.utf8 = true, enc == encodingAuto
+		r.fallback = r.encoding
+	default:
+		f.Close()
+		return nil, fmt.Errorf("unknown encoding %q", enc)
+	}
+	if r.fallback != "" {
+		r.decoder = legacyCharmaps[r.fallback].NewDecoder()
+	}
+
+	r.scanner = bufio.NewScanner(reader)
+	// Increase maximum token size if needed.
+	buf := make([]byte, 1024)
+	r.scanner.Buffer(buf, 10*1024*1024)
+	return r, nil
+}
+
+// Scan advances to the next line, which is then available through Text.
+func (r *lineReader) Scan() bool {
+	if !r.scanner.Scan() {
+		return false
+	}
+	line := r.scanner.Bytes()
+	switch {
+	case !r.perLine:
+		r.text = r.scanner.Text()
+		r.lines[r.encoding]++
+	case r.utf8 && utf8.Valid(line):
+		r.text = string(line)
+		if isASCII(r.text) {
+			r.lines[r.encoding]++
+		} else {
+			r.lines[encodingUTF8]++
+		}
+	case r.decoder != nil:
+		decoded, _ := r.decoder.Bytes(line)
+		r.text = string(decoded)
+		r.lines[r.fallback]++
+	default:
+		// Invalid UTF-8 in a file configured as UTF-8.
+		r.text = strings.ToValidUTF8(string(line), string(utf8.RuneError))
+		r.lines[r.encoding]++
+	}
+	return true
+}
+
+// Text returns the last line read by Scan.
+func (r *lineReader) Text() string {
+	return r.text
+}
+
+func (r *lineReader) Err() error {
+	return r.scanner.Err()
+}
+
+func (r *lineReader) Close() error {
+	return r.file.Close()
+}
+
+// isASCII reports whether s holds only ASCII characters.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
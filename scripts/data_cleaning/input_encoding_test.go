@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"golang.org/x/text/encoding/unicode"
+)
+
+// utf16Bytes encodes s as UTF-16 with a byte order mark.
+func utf16Bytes(t *testing.T, endianness unicode.Endianness, s string) []byte {
+	t.Helper()
+	data, err := unicode.UTF16(endianness, unicode.UseBOM).NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDetectEncoding(t *testing.T) {
+	tests := []struct {
+		name   string
+		sample []byte
+		want   string
+		bom    int
+	}{
+		{"empty", nil, encodingUTF8, 0},
+		{"ascii", []byte("bob@a.com:secret\n"), encodingUTF8, 0},
+		{"utf-8", []byte("müller@web.de:grüße12\n"), encodingUTF8, 0},
+		{"utf-8 cut off mid character", []byte("bob@a.com:пароль")[:20], encodingUTF8, 0},
+		{"utf-8 with bom", []byte("\xef\xbb\xbfbob@a.com:secret\n"), encodingUTF8, 3},
+		{"utf-16le with bom", utf16Bytes(t, unicode.LittleEndian, "bob@a.com:secret\n"), encodingUTF16LE, 2},
+		{"utf-16be with bom", utf16Bytes(t, unicode.BigEndian, "bob@a.com:secret\n"), encodingUTF16BE, 2},
+		{"latin-1 umlauts and sharp s", []byte("m\xfcller@web.de:gr\xfc\xdfe12\n"), encodingLatin1, 0},
+		{"latin-1 accents", []byte("jos\xe9@correo.es:ni\xf1o\nfran\xe7ois@mail.fr:\xe9t\xe9\n"), encodingLatin1, 0},
+		{"latin-1 accented letters side by side", []byte("bob@a.com:\xfc\xdf\n"), encodingLatin1, 0},
+		{"windows-1251 lower case", []byte("ivan@mail.ru:\xef\xe0\xf0\xee\xeb\xfc\n"), encodingWindows1251, 0},
+		{"windows-1251 capitalized", []byte("ivan@mail.ru:\xc8\xe2\xe0\xed1985\n"), encodingWindows1251, 0},
+		{"windows-1251 upper case", []byte("ivan@mail.ru:\xcf\xc0\xd0\xce\xcb\xdc\n"), encodingWindows1251, 0},
+		{"windows-1251 too little evidence", []byte("ivan@mail.ru:\xe4\xe0\n"), encodingLatin1, 0},
+		{
+			"windows-1251 outweighing latin-1",
+			[]byte("ivan@mail.ru:\xef\xe0\xf0\xee\xeb\xfc\nolga@mail.ru:\xec\xee\xf1\xea\xe2\xe0\nm\xfcller@web.de:x\n"),
+			encodingWindows1251, 0,
+		},
+	}
+
+	for _, tt := range tests {
+		got, bom := detectEncoding(tt.sample)
+		if got != tt.want || bom != tt.bom {
+			t.Errorf("%s: detectEncoding = %s, %d, want %s, %d", tt.name, got, bom, tt.want, tt.bom)
+		}
+	}
+}
+
+func TestLineReader(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		enc  string
+		want []string
+		// lines counts the lines read by the encoding they were decoded with.
+		lines map[string]int64
+	}{
+		{
+			name:  "utf-8",
+			data:  []byte("bob@a.com:secret\nmüller@web.de:grüße12\n"),
+			enc:   encodingAuto,
+			want:  []string{"bob@a.com:secret", "müller@web.de:grüße12"},
+			lines: map[string]int64{encodingUTF8: 2},
+		},
+		{
+			name:  "utf-8 bom is dropped",
+			data:  []byte("\xef\xbb\xbfbob@a.com:secret\n"),
+			enc:   encodingAuto,
+			want:  []string{"bob@a.com:secret"},
+			lines: map[string]int64{encodingUTF8: 1},
+		},
+		{
+			name:  "utf-16le",
+			data:  utf16Bytes(t, unicode.LittleEndian, "bob@a.com:secret\nivan@mail.ru:пароль\n"),
+			enc:   encodingAuto,
+			want:  []string{"bob@a.com:secret", "ivan@mail.ru:пароль"},
+			lines: map[string]int64{encodingUTF16LE: 2},
+		},
+		{
+			name:  "utf-16be",
+			data:  utf16Bytes(t, unicode.BigEndian, "müller@web.de:grüße12\n"),
+			enc:   encodingAuto,
+			want:  []string{"müller@web.de:grüße12"},
+			lines: map[string]int64{encodingUTF16BE: 1},
+		},
+		{
+			name:  "latin-1",
+			data:  []byte("bob@a.com:secret\nm\xfcller@web.de:gr\xfc\xdfe12\n"),
+			enc:   encodingAuto,
+			want:  []string{"bob@a.com:secret", "müller@web.de:grüße12"},
+			lines: map[string]int64{encodingLatin1: 2},
+		},
+		{
+			name:  "windows-1251",
+			data:  []byte("ivan@mail.ru:\xef\xe0\xf0\xee\xeb\xfc\n"),
+			enc:   encodingAuto,
+			want:  []string{"ivan@mail.ru:пароль"},
+			lines: map[string]int64{encodingWindows1251: 1},
+		},
+		{
+			name:  "utf-8 with latin-1 lines",
+			data:  []byte("ivan@mail.ru:пароль\nm\xfcller@web.de:gr\xfc\xdfe12\n"),
+			enc:   encodingAuto,
+			want:  []string{"ivan@mail.ru:пароль", "müller@web.de:grüße12"},
+			lines: map[string]int64{encodingUTF8: 1, encodingLatin1: 1},
+		},
+		{
+			name:  "utf-8 with windows-1251 lines",
+			data:  []byte("müller@web.de:grüße12\nivan@mail.ru:\xef\xe0\xf0\xee\xeb\xfc\n"),
+			enc:   encodingAuto,
+			want:  []string{"müller@web.de:grüße12", "ivan@mail.ru:пароль"},
+			lines: map[string]int64{encodingUTF8: 1, encodingWindows1251: 1},
+		},
+		{
+			name:  "configured windows-1251",
+			data:  []byte("m\xfcller@web.de:x\n"),
+			enc:   encodingWindows1251,
+			want:  []string{"mьller@web.de:x"},
+			lines: map[string]int64{encodingWindows1251: 1},
+		},
+		{
+			name:  "configured utf-8 replaces invalid bytes",
+			data:  []byte("m\xfcller@web.de:x\n"),
+			enc:   encodingUTF8,
+			want:  []string{"m�ller@web.de:x"},
+			lines: map[string]int64{encodingUTF8: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		r, err := newLineReader("test.txt", io.NopCloser(bytes.NewReader(tt.data)), tt.enc)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var got []string
+		for r.Scan() {
+			got = append(got, r.Text())
+		}
+		if err := r.Err(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		r.Close()
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: read %q, want %q", tt.name, got, tt.want)
+		}
+		if !reflect.DeepEqual(r.lines, tt.lines) {
+			t.Errorf("%s: line counts %v, want %v", tt.name, r.lines, tt.lines)
+		}
+	}
+}
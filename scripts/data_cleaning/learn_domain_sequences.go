@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// learnedSequence is a domain sequence found by learn-sequences: a sorted
+// list of domains that runs of one local part and one password were spread
+// across, and how many such runs there were.
+type learnedSequence struct {
+	Domains []string `json:"domains"`
+	Support int      `json:"support"`
+	// Known is set when the sequence is one of suspicious_email.sequences already.
+	Known bool `json:"known"`
+}
+
+// sequenceKey returns the key a domain sequence is counted under.
+func sequenceKey(domains []string) string {
+	return strings.Join(domains, " ")
+}
+
+// countDomainRuns counts the runs of at least minDomains domains in strictly
+// increasing order in a local part and password group, taken in input order:
+// the output of a generator that sends one account to a sorted list of
+// providers. A domain that does not sort after the previous one starts a new run.
+func countDomainRuns(group []sortRecord, minDomains int, support map[string]int) {
+	var run []string
+	end := func() {
+		if len(run) >= minDomains {
+			support[sequenceKey(run)]++
+		}
+		run = run[:0]
+	}
+	for _, rec := range group {
+		if len(run) > 0 && rec.Value <= run[len(run)-1] {
+			end()
+		}
+		run = append(run, rec.Value)
+	}
+	end()
+}
+
+// learnDomainSequences groups the credentials of every file below srcDir by
+// local part and password, sorting them on disk, and counts the runs of each
+// group whose domains are in strictly increasing order, however far apart
+// their lines are. It returns the sequences of at least MinSupport runs, the
+// most frequent first.
+func learnDomainSequences(srcDir string, cfg *Config) ([]learnedSequence, error) {
+	se := cfg.SuspiciousEmail
+	workDir, err := os.MkdirTemp(cfg.Engine.TempDir, "learn-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(workDir)
+
+	byLocal := newExternalSorter(workDir, cfg.Engine.SortMemoryMB<<20)
+	var seq int64
+	err = walkSources(srcDir, func(src sourceFile) error {
+		if src.isDir {
+			return nil
+		}
+		fs, err := openFileSource(src, cfg.Input.Encoding)
+		if err != nil {
+			return err
+		}
+		defer fs.Close()
+		for {
+			cred, err := fs.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %v", src.path, err)
+			}
+			seq++
+			if err := addByLocalPart(byLocal, cred, seq); err != nil {
+				return err
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	support := make(map[string]int)
+	err = forEachLocalPartGroup(byLocal, func(group []sortRecord) error {
+		if len(group) >= se.MinDomains {
+			countDomainRuns(group, se.MinDomains, support)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool)
+	for _, seq := range se.Sequences {
+		known[sequenceKey(seq)] = true
+	}
+	var sequences []learnedSequence
+	for key, n := range support {
+		if n < se.MinSupport {
+			continue
+		}
+		sequences = append(sequences, learnedSequence{
+			Domains: strings.Split(key, " "),
+			Support: n,
+			Known:   known[key],
+		})
+	}
+	sort.Slice(sequences, func(i, j int) bool {
+		if sequences[i].Support != sequences[j].Support {
+			return sequences[i].Support > sequences[j].Support
+		}
+		return sequenceKey(sequences[i].Domains) < sequenceKey(sequences[j].Domains)
+	})
+	return sequences, nil
+}
+
+// loadLearnedSequences reads the list written by learn-sequences.
+func loadLearnedSequences(path string) ([]learnedSequence, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening learned sequences file: %v", err)
+	}
+	defer file.Close()
+
+	var sequences []learnedSequence
+	if err := json.NewDecoder(file).Decode(&sequences); err != nil {
+		return nil, fmt.Errorf("error decoding learned sequences: %v", err)
+	}
+	for i, seq := range sequences {
+		if len(seq.Domains) < 2 {
+			return nil, fmt.Errorf("%s: sequence %d needs at least two domains", path, i)
+		}
+	}
+	return sequences, nil
+}
+
+// cmdLearnSequences implements the learn-sequences subcommand.
+func cmdLearnSequences(args []string) error {
+	fs := flag.NewFlagSet("learn-sequences", flag.ExitOnError)
+	configFile := configFlag(fs)
+	srcDir := fs.String("src", "../../data", "directory containing the breach files")
+	outputPath := fs.String("out", "", "file to write the domain sequences to (defaults to the config's suspicious_email.learned_file)")
+	minDomains := fs.Int("min-domains", 0, "domains a run needs (overrides the config)")
+	minSupport := fs.Int("min-support", 0, "runs a sequence needs to be reported (overrides the config)")
+	fs.Parse(args)
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	if flagWasSet(fs, "min-domains") {
+		cfg.SuspiciousEmail.MinDomains = *minDomains
+	}
+	if flagWasSet(fs, "min-support") {
+		cfg.SuspiciousEmail.MinSupport = *minSupport
+	}
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	if *outputPath == "" {
+		*outputPath = cfg.SuspiciousEmail.LearnedFile
+	}
+
+	sequences, err := learnDomainSequences(*srcDir, cfg)
+	if err != nil {
+		return fmt.Errorf("error learning domain sequences: %v", err)
+	}
+
+	outputFile, err := os.Create(*outputPath)
+	if err != nil {
+		return fmt.Errorf("error creating output file: %v", err)
+	}
+	defer outputFile.Close()
+
+	encoder := json.NewEncoder(outputFile)
+	encoder.SetIndent("", "  ")
+	if sequences == nil {
+		sequences = []learnedSequence{}
+	}
+	if err := encoder.Encode(sequences); err != nil {
+		return fmt.Errorf("error writing output: %v", err)
+	}
+
+	newSequences := 0
+	for _, seq := range sequences {
+		if seq.Known {
+			continue
+		}
+		newSequences++
+		fmt.Printf("%8d  %s\n", seq.Support, strings.Join(seq.Domains, " "))
+	}
+	fmt.Printf("Found %d domain sequences, %d of them new. Results written to %s\n", len(sequences), newSequences, *outputPath)
+	return nil
+}
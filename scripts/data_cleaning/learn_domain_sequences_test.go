@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLearnDomainSequences(t *testing.T) {
+	tests := []struct {
+		name string
+		// files are the breach files below the source directory, by name.
+		files map[string]string
+		want  []learnedSequence
+	}{
+		{
+			name: "sorted group",
+			files: map[string]string{
+				"a.txt": "bob@a.com:pw\nbob@b.com:pw\nbob@c.com:pw\n",
+			},
+			want: []learnedSequence{{Domains: []string{"@a.com", "@b.com", "@c.com"}, Support: 1}},
+		},
+		{
+			name: "sorted group with other lines in between",
+			files: map[string]string{
+				"a.txt": "bob@a.com:pw\nann@z.com:x\nbob@b.com:pw\nann@y.com:x\nbob@c.com:pw\n",
+			},
+			want: []learnedSequence{{Domains: []string{"@a.com", "@b.com", "@c.com"}, Support: 1}},
+		},
+		{
+			name: "unsorted group",
+			files: map[string]string{
+				"a.txt": "bob@b.com:pw\nbob@a.com:pw\nbob@c.com:pw\n",
+			},
+		},
+		{
+			name: "repeated domain ends the run",
+			files: map[string]string{
+				"a.txt": "bob@a.com:pw\nbob@b.com:pw\nbob@b.com:pw\nbob@c.com:pw\n",
+			},
+		},
+		{
+			name: "other password is another group",
+			files: map[string]string{
+				"a.txt": "bob@a.com:pw\nbob@b.com:other\nbob@c.com:pw\n",
+			},
+		},
+		{
+			name: "group split across files",
+			files: map[string]string{
+				"a.txt": "bob@a.com:pw\nbob@b.com:pw\n",
+				"b.txt": "bob@c.com:pw\nbob@d.com:pw\n",
+			},
+			want: []learnedSequence{{Domains: []string{"@a.com", "@b.com", "@c.com", "@d.com"}, Support: 1}},
+		},
+		{
+			name: "group split across files out of order",
+			files: map[string]string{
+				"a.txt": "bob@c.com:pw\nbob@d.com:pw\n",
+				"b.txt": "bob@a.com:pw\nbob@b.com:pw\n",
+			},
+		},
+		{
+			name: "support counts runs",
+			files: map[string]string{
+				"a.txt": "bob@a.com:pw\nbob@b.com:pw\nbob@c.com:pw\nbob@a.com:pw\nbob@b.com:pw\nbob@c.com:pw\n",
+				"b.txt": "ann@a.com:x\nann@b.com:x\nann@c.com:x\nann@d.com:x\n",
+			},
+			want: []learnedSequence{
+				{Domains: []string{"@a.com", "@b.com", "@c.com"}, Support: 2},
+				{Domains: []string{"@a.com", "@b.com", "@c.com", "@d.com"}, Support: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		srcDir := t.TempDir()
+		for name, text := range tt.files {
+			if err := os.WriteFile(filepath.Join(srcDir, name), []byte(text), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		cfg := defaultConfig()
+		cfg.Engine.TempDir = t.TempDir()
+		cfg.SuspiciousEmail.MinDomains = 3
+		cfg.SuspiciousEmail.MinSupport = 1
+
+		got, err := learnDomainSequences(srcDir, cfg)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
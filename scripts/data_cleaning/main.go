@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+// command is a subcommand of the data cleaning binary.
+type command struct {
+	name        string
+	description string
+	run         func(args []string) error
+}
+
+var commands = []command{
+	{"clean", "remove artificial credentials from a breach directory", cmdClean},
+	{"count", "count what clean would remove without writing anything", cmdCount},
+	{"organize", "sort the passwords of a breach directory into per-letter files", cmdOrganize},
+	{"distribution", "compute follow-on character distributions", cmdDistribution},
+	{"extract-prefixes", "log prefixes whose follow-on distribution is an outlier", cmdExtractPrefixes},
+	{"ratio-stats", "compute standalone to following ratios for common prefixes", cmdRatioStats},
+	{"identify-for", "select passwords with suspicious follow-on ratios", cmdIdentifyFor},
+	{"learn-sequences", "find domain sequences one account was spread across", cmdLearnSequences},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-18s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for the flags of a command.\n", os.Args[0])
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			if err := cmd.run(os.Args[2:]); err != nil {
+				log.Fatalf("%s: %v", cmd.name, err)
+			}
+			return
+		}
+	}
+
+	usage()
+	os.Exit(2)
+}
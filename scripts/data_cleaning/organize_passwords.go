@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// passwordGroup returns the file group of a password: its first letter in
+// lower case, its first digit, or "symbols" for anything else. Every prefix of
+// a password therefore lands in the same file, so the per-file tries of the
+// analysis subcommands see complete prefix counts.
+func passwordGroup(password string) string {
+	c := password[0]
+	switch {
+	case c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		return string(c)
+	case c >= 'A' && c <= 'Z':
+		return string(c - 'A' + 'a')
+	}
+	return "symbols"
+}
+
+// OrganizePasswords reads every breach file of srcDir, including the members
+// of zip and tar archives, in the given input encoding and writes one
+// <group>_passwords.txt file per passwordGroup to destDir, with the
+// credentials sorted by password. Credentials with the same password keep
+// their input order. The sort spills to tmpDir once sortMemory bytes are buffered.
+func OrganizePasswords(srcDir, destDir, encoding, tmpDir string, sortMemory int) error {
+	workDir, err := os.MkdirTemp(tmpDir, "organize-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+
+	// Sort by group, then password, then input position.
+	sorter := newExternalSorter(workDir, sortMemory)
+	var seq int64
+	err = walkSources(srcDir, func(src sourceFile) error {
+		if src.isDir {
+			return nil
+		}
+		fmt.Printf("Processing file: %s\n", src.path)
+		fs, err := openFileSource(src, encoding)
+		if err != nil {
+			return err
+		}
+		defer fs.Close()
+		for {
+			cred, err := fs.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %v", src.path, err)
+			}
+			if cred.Password == "" {
+				continue
+			}
+			seq++
+			rec := sortRecord{Key: passwordGroup(cred.Password) + "\x00" + cred.Password, Seq: seq, Value: cred.Username}
+			if err := sorter.Add(rec); err != nil {
+				return err
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(destDir, os.ModePerm); err != nil {
+		return err
+	}
+	var out *os.File
+	var w *bufio.Writer
+	closeOut := func() error {
+		if out == nil {
+			return nil
+		}
+		if err := w.Flush(); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	}
+
+	group := ""
+	err = forEachSorted(sorter, func(rec sortRecord) error {
+		recGroup, password, _ := strings.Cut(rec.Key, "\x00")
+		if out == nil || recGroup != group {
+			if err := closeOut(); err != nil {
+				return err
+			}
+			group = recGroup
+			path := filepath.Join(destDir, group+"_passwords.txt")
+			fmt.Printf("Writing file: %s\n", path)
+			f, err := os.Create(path)
+			if err != nil {
+				return err
+			}
+			out, w = f, bufio.NewWriter(f)
+		}
+		_, err := w.WriteString(rec.Value + ":" + password + "\n")
+		return err
+	})
+	if err != nil {
+		if out != nil {
+			out.Close()
+		}
+		return err
+	}
+	return closeOut()
+}
+
+// cmdOrganize implements the organize subcommand.
+func cmdOrganize(args []string) error {
+	fs := flag.NewFlagSet("organize", flag.ExitOnError)
+	configFile := configFlag(fs)
+	srcDir := fs.String("src", "../../data", "directory containing the breach files")
+	destDir := fs.String("dest", "../OrganizedPasswords", "directory to write the *_passwords.txt files to")
+	fs.Parse(args)
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+
+	if err := OrganizePasswords(*srcDir, *destDir, cfg.Input.Encoding, cfg.Engine.TempDir, cfg.Engine.SortMemoryMB<<20); err != nil {
+		return fmt.Errorf("error organizing passwords: %v", err)
+	}
+	fmt.Printf("Password files written to %s\n", *destDir)
+	return nil
+}
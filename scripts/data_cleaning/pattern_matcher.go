@@ -0,0 +1,171 @@
+package main
+
+// Where a pattern must occur in a string for patternMatcher to report it.
+const (
+	matchExact = iota
+	matchPrefix
+	matchSuffix
+	matchSubstring
+)
+
+// patternMatcher is an Aho-Corasick automaton over a set of exact, prefix,
+// suffix and substring patterns. Once compiled it finds the patterns a
+// string matches in one pass over the string, in time that depends on the
+// length of the string and not on the number of patterns.
+type patternMatcher struct {
+	nodes []acNode
+	// edges holds the trie transitions, keyed by node<<8 | byte.
+	edges    map[uint64]int32
+	patterns []acPattern
+	compiled bool
+}
+
+// acNode is a state of the automaton: the pattern prefix spelled by the trie path to it.
+type acNode struct {
+	// fail is the node of the longest proper suffix of this node's string
+	// that is also in the trie.
+	fail int32
+	// output is the nearest node on the fail chain, this node included,
+	// where a pattern ends, or -1.
+	output int32
+	// patterns are the indexes of the patterns ending at this node.
+	patterns []int32
+}
+
+// acPattern is a pattern added to the matcher.
+type acPattern struct {
+	kind   int
+	length int
+	id     int
+}
+
+func newPatternMatcher() *patternMatcher {
+	return &patternMatcher{
+		nodes: []acNode{{output: -1}},
+		edges: make(map[uint64]int32),
+	}
+}
+
+func (m *patternMatcher) child(node int32, c byte) (int32, bool) {
+	next, ok := m.edges[uint64(node)<<8|uint64(c)]
+	return next, ok
+}
+
+// add adds a pattern of the given kind, reported by match as id. Patterns
+// cannot be added once the matcher is compiled.
+func (m *patternMatcher) add(pattern string, kind, id int) {
+	if m.compiled {
+		panic("patternMatcher: add after compile")
+	}
+	node := int32(0)
+	for i := 0; i < len(pattern); i++ {
+		next, ok := m.child(node, pattern[i])
+		if !ok {
+			next = int32(len(m.nodes))
+			m.nodes = append(m.nodes, acNode{output: -1})
+			m.edges[uint64(node)<<8|uint64(pattern[i])] = next
+		}
+		node = next
+	}
+	m.nodes[node].patterns = append(m.nodes[node].patterns, int32(len(m.patterns)))
+	m.patterns = append(m.patterns, acPattern{kind: kind, length: len(pattern), id: id})
+}
+
+// compile computes the failure links, breadth first from the root. It is
+// called once, after the last pattern is added.
+func (m *patternMatcher) compile() {
+	// children lists the trie children of each node, by byte.
+	type edge struct {
+		c    byte
+		node int32
+	}
+	children := make([][]edge, len(m.nodes))
+	for key, next := range m.edges {
+		parent := key >> 8
+		children[parent] = append(children[parent], edge{c: byte(key), node: next})
+	}
+
+	if len(m.nodes[0].patterns) > 0 {
+		m.nodes[0].output = 0
+	}
+	queue := []int32{0}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for _, e := range children[node] {
+			fail := int32(0)
+			if node != 0 {
+				// Follow the failure links of the parent until one has a
+				// transition on the same byte.
+				for f := m.nodes[node].fail; ; f = m.nodes[f].fail {
+					if next, ok := m.child(f, e.c); ok {
+						fail = next
+						break
+					}
+					if f == 0 {
+						break
+					}
+				}
+			}
+			child := &m.nodes[e.node]
+			child.fail = fail
+			if len(child.patterns) > 0 {
+				child.output = e.node
+			} else {
+				child.output = m.nodes[fail].output
+			}
+			queue = append(queue, e.node)
+		}
+	}
+	m.compiled = true
+}
+
+// match returns the lowest id of the patterns s matches, and false if it
+// matches none. A pattern matches if it occurs in s where its kind requires:
+// as all of s, at its start, at its end or anywhere. The matcher must be
+// compiled; match may then be called from several goroutines.
+func (m *patternMatcher) match(s string) (int, bool) {
+	best, found := 0, false
+	consider := func(node int32, end int) {
+		for ; node >= 0; node = m.nodes[m.nodes[node].fail].output {
+			for _, p := range m.nodes[node].patterns {
+				pattern := m.patterns[p]
+				atStart, atEnd := end == pattern.length, end == len(s)
+				var ok bool
+				switch pattern.kind {
+				case matchExact:
+					ok = atStart && atEnd
+				case matchPrefix:
+					ok = atStart
+				case matchSuffix:
+					ok = atEnd
+				case matchSubstring:
+					ok = true
+				}
+				if ok && (!found || pattern.id < best) {
+					best, found = pattern.id, true
+				}
+			}
+			if node == 0 {
+				break
+			}
+		}
+	}
+
+	node := int32(0)
+	consider(m.nodes[0].output, 0)
+	for i := 0; i < len(s); i++ {
+		for {
+			if next, ok := m.child(node, s[i]); ok {
+				node = next
+				break
+			}
+			if node == 0 {
+				break
+			}
+			node = m.nodes[node].fail
+		}
+		consider(m.nodes[node].output, i+1)
+	}
+	return best, found
+}
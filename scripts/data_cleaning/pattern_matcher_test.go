@@ -0,0 +1,154 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// testPattern is a pattern of a test list; its id is its index.
+type testPattern struct {
+	pattern string
+	kind    int
+}
+
+// bruteForceMatch is what patternMatcher.match computes, checked pattern by
+// pattern with the strings functions.
+func bruteForceMatch(patterns []testPattern, s string) (int, bool) {
+	for id, p := range patterns {
+		var ok bool
+		switch p.kind {
+		case matchExact:
+			ok = s == p.pattern
+		case matchPrefix:
+			ok = strings.HasPrefix(s, p.pattern)
+		case matchSuffix:
+			ok = strings.HasSuffix(s, p.pattern)
+		case matchSubstring:
+			ok = strings.Contains(s, p.pattern)
+		}
+		if ok {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+func TestPatternMatcher(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []testPattern
+		inputs   []string
+	}{
+		{
+			name:     "empty list",
+			patterns: nil,
+			inputs:   []string{"", "password"},
+		},
+		{
+			name: "one of each kind",
+			patterns: []testPattern{
+				{"123456", matchExact},
+				{"qwerty", matchPrefix},
+				{"2024", matchSuffix},
+				{"dragon", matchSubstring},
+			},
+			inputs: []string{"123456", "1234567", "0123456", "qwerty", "qwerty1", "1qwerty", "2024", "pass2024", "2024pass",
+				"dragon", "mydragon1", "drago", "", "password"},
+		},
+		{
+			name: "patterns sharing prefixes and suffixes",
+			patterns: []testPattern{
+				{"abc", matchSuffix},
+				{"ab", matchPrefix},
+				{"bc", matchExact},
+				{"b", matchSubstring},
+				{"abcd", matchExact},
+			},
+			inputs: []string{"abcd", "abc", "xabc", "bc", "b", "ab", "cab", "acd", "aabcc", "c"},
+		},
+		{
+			name: "patterns inside other patterns",
+			patterns: []testPattern{
+				{"aaaa", matchExact},
+				{"aa", matchSuffix},
+				{"aaa", matchPrefix},
+				{"ba", matchSubstring},
+				{"a", matchExact},
+			},
+			inputs: []string{"a", "aa", "aaa", "aaaa", "aaaaa", "baa", "aab", "bab", "b", "abab"},
+		},
+		{
+			name: "the same value with different kinds",
+			patterns: []testPattern{
+				{"pass", matchSubstring},
+				{"pass", matchExact},
+				{"pass", matchPrefix},
+			},
+			inputs: []string{"pass", "password", "mypass", "pas"},
+		},
+		{
+			name: "an earlier entry wins only where its kind matches",
+			patterns: []testPattern{
+				{"love", matchExact},
+				{"iloveyou", matchSuffix},
+				{"love", matchSubstring},
+				{"ilove", matchPrefix},
+			},
+			inputs: []string{"love", "iloveyou", "xiloveyou", "ilovecats", "lovely", "ilov"},
+		},
+		{
+			name: "non-ASCII and binary bytes",
+			patterns: []testPattern{
+				{"пароль", matchSubstring},
+				{"\x00\xff", matchPrefix},
+				{"ü", matchSuffix},
+			},
+			inputs: []string{"мойпароль1", "\x00\xffabc", "a\x00\xff", "müller", "über", "tschüß", "straßeü"},
+		},
+	}
+
+	for _, tt := range tests {
+		m := newPatternMatcher()
+		for id, p := range tt.patterns {
+			m.add(p.pattern, p.kind, id)
+		}
+		m.compile()
+		for _, s := range tt.inputs {
+			gotID, gotFound := m.match(s)
+			wantID, wantFound := bruteForceMatch(tt.patterns, s)
+			if gotFound != wantFound || gotID != wantID {
+				t.Errorf("%s: match(%q) = %d, %v, want %d, %v", tt.name, s, gotID, gotFound, wantID, wantFound)
+			}
+		}
+	}
+}
+
+// TestPatternMatcherAllSubstrings checks every substring of a few passwords
+// against a list of every kind of pattern built from the same alphabet.
+func TestPatternMatcherAllSubstrings(t *testing.T) {
+	values := []string{"a", "ab", "ba", "aba", "bab", "abab", "bb", "aab"}
+	var patterns []testPattern
+	for _, kind := range []int{matchSuffix, matchExact, matchSubstring, matchPrefix} {
+		for _, v := range values {
+			patterns = append(patterns, testPattern{v, kind})
+		}
+	}
+	m := newPatternMatcher()
+	for id, p := range patterns {
+		m.add(p.pattern, p.kind, id)
+	}
+	m.compile()
+
+	for _, password := range []string{"abababbaab", "bbbaaab", "aaaaab"} {
+		for i := 0; i <= len(password); i++ {
+			for j := i; j <= len(password); j++ {
+				s := password[i:j]
+				gotID, gotFound := m.match(s)
+				wantID, wantFound := bruteForceMatch(patterns, s)
+				if gotFound != wantFound || gotID != wantID {
+					t.Errorf("match(%q) = %d, %v, want %d, %v", s, gotID, gotFound, wantID, wantFound)
+				}
+			}
+		}
+	}
+}
@@ -3,11 +3,13 @@ package main
 import (
 	"bufio"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"unicode/utf8"
 )
 
 /*
@@ -16,11 +18,19 @@ import (
 
 */
 
-// CharacterStats holds the statistical information for each character
+// CharacterStats holds the statistical information for each character. The
+// values are shares between 0 and 1 of the characters following a prefix.
 type CharacterStats struct {
-	Average  float64
+	Average float64
+	// MinRange and MaxRange are the lower and upper percentiles of the analysis config.
 	MinRange float64
 	MaxRange float64
+	Median   float64
+	StdDev   float64
+	// Samples is how many prefixes the character followed.
+	Samples int
+	// Percentiles holds the extra percentiles of the analysis config, keyed "p<percentile>".
+	Percentiles map[string]float64 `json:",omitempty"`
 }
 
 // Analysis thresholds
@@ -53,9 +63,11 @@ func LoadCharacterStats(filePath string) error {
 
 	// Convert string keys to rune keys and populate global variable
 	for key, value := range stats {
-		if len(key) == 1 {
-			GlobalCharStats[rune(key[0])] = value
+		char, size := utf8.DecodeRuneInString(key)
+		if size == 0 || size != len(key) {
+			return fmt.Errorf("key %q is not a single character", key)
 		}
+		GlobalCharStats[char] = value
 	}
 
 	// Log the loaded stats for verification
@@ -63,33 +75,6 @@ func LoadCharacterStats(filePath string) error {
 	return nil
 }
 
-// LoadCredentialsFromFile loads passwords from a file and inserts them into the trie.
-func LoadCredentialsFromFile(filePath string, passTrie *Trie) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		log.Printf("Error opening file %s: %v", filePath, err)
-		return
-	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		splitLine := strings.Split(line, ":")
-		if len(splitLine) < 2 {
-			continue
-		}
-		password := strings.TrimSpace(splitLine[1])
-		if password != "" {
-			passTrie.Insert(password)
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		log.Printf("Error reading file %s: %v", filePath, err)
-	}
-}
-
 // isDistributionOutlier checks if the character distribution for a prefix is an outlier
 func isDistributionOutlier(char rune, percentage float64, stats CharacterStats) bool {
 	return percentage > stats.MaxRange
@@ -107,7 +92,7 @@ func isHighStandaloneWithFewFollowing(standaloneCount int, totalFollowingCount i
 }
 
 // ScanForSuspiciousPrefixes processes password files and logs suspicious prefixes.
-func ScanForSuspiciousPrefixes(srcDir string, distributionFile string, occurrenceThreshold int) {
+func ScanForSuspiciousPrefixes(srcDir, encoding string, distributionFile string, occurrenceThreshold int, minOutlierShare float64) {
 	distFile, err := os.Create(distributionFile)
 
 	if err != nil {
@@ -122,11 +107,11 @@ func ScanForSuspiciousPrefixes(srcDir string, distributionFile string, occurrenc
 			log.Printf("Error accessing file %s: %v", path, err)
 			return nil
 		}
-		if strings.HasSuffix(info.Name(), "_passwords.txt") {
+		if strings.HasSuffix(trimCompressionExt(info.Name()), "_passwords.txt") {
 			fmt.Printf("Processing file: %s\n", info.Name())
 
 			passTrie := NewTrie()
-			LoadCredentialsFromFile(path, passTrie)
+			LoadCredentialsFromFile(path, encoding, passTrie)
 			highStandalone := collectHighStandalone(passTrie, occurrenceThreshold)
 
 			// Write file header
@@ -149,7 +134,7 @@ func ScanForSuspiciousPrefixes(srcDir string, distributionFile string, occurrenc
 					if stats, exists := GlobalCharStats[char]; exists {
 						percentage := float64(count) / float64(totalFollowingCount)
 						if isDistributionOutlier(char, percentage, stats) {
-							if percentage > 0.005 {
+							if percentage > minOutlierShare {
 								outlierFound = true
 								outlierChars = append(outlierChars, fmt.Sprintf("'%c' (%.4f%%)", char, percentage*100))
 							}
@@ -185,63 +170,31 @@ func ScanForSuspiciousPrefixes(srcDir string, distributionFile string, occurrenc
 	fmt.Printf("Suspicious prefixes have been logged in %s\n", distributionFile)
 }
 
-// collectHighStandalone returns all prefixes with standalone occurrences above the threshold.
-func collectHighStandalone(passTrie *Trie, occurrenceThreshold int) []string {
-	var highStandalonePrefixes []string
-	collectHighStandaloneRecursive(passTrie.root, "", occurrenceThreshold, &highStandalonePrefixes)
-	return highStandalonePrefixes
-}
-
-// Helper recursive function to traverse the trie and collect prefixes meeting the threshold.
-func collectHighStandaloneRecursive(node *TrieNode, currentPrefix string, occurrenceThreshold int, results *[]string) {
-	// If this node marks the end of a word and meets the threshold, add it to the results.
-	if node.endOfWordCount > occurrenceThreshold {
-		*results = append(*results, currentPrefix)
-	}
-
-	// Recursively check each child to continue building longer prefixes.
-	for char, child := range node.children {
-		newPrefix := currentPrefix + string(char)
-		collectHighStandaloneRecursive(child, newPrefix, occurrenceThreshold, results)
-	}
-}
-
-// collectFollowingChars counts the occurrences of characters that follow the given prefix.
-func collectFollowingChars(passTrie *Trie, prefix string) map[rune]int {
-	followingCharCount := make(map[rune]int)
-
-	// Find the node for the given prefix
-	node := passTrie.root
-	for _, char := range prefix {
-		if _, exists := node.children[char]; !exists {
-			return followingCharCount // Return empty if the prefix doesn't exist
-		}
-		node = node.children[char]
+// cmdExtractPrefixes implements the extract-prefixes subcommand.
+func cmdExtractPrefixes(args []string) error {
+	fs := flag.NewFlagSet("extract-prefixes", flag.ExitOnError)
+	configFile := configFlag(fs)
+	srcDir := fs.String("src", "../OrganizedPasswords", "directory containing *_passwords.txt files")
+	statsFile := fs.String("stats", "char_distributions.json", "character distribution statistics to compare against")
+	distributionFile := fs.String("out", "suspicious_distributions.txt", "file to log suspicious prefixes to")
+	occurrenceThreshold := fs.Int("threshold", 0, "minimum standalone occurrences for a prefix to be checked (overrides the config)")
+	fs.Parse(args)
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
 	}
-
-	// Now count all characters in the subtree that follow the prefix
-	for childChar, childNode := range node.children {
-		// The count of this character is the count of all its words in the subtree
-		count := countWordsInSubTrie(childNode)
-		followingCharCount[childChar] = count
+	if !flagWasSet(fs, "threshold") {
+		*occurrenceThreshold = cfg.Analysis.PrefixThreshold
 	}
 
-	return followingCharCount
-}
-
-func main() {
-	// Specify the file paths and threshold
-	passwordFile := "../OrganizedPasswords/"
-	distributionFile := "suspicious_distributions.txt"
-	occurrenceThreshold := 1000
-
-	err := LoadCharacterStats("../char_distributions.json")
-	if err != nil {
-		log.Fatalf("Failed to load character stats: %v", err)
+	if err := LoadCharacterStats(*statsFile); err != nil {
+		return fmt.Errorf("failed to load character stats: %v", err)
 	}
 
 	// Extract patterns and save them to a file
-	ScanForSuspiciousPrefixes(passwordFile, distributionFile, occurrenceThreshold)
+	ScanForSuspiciousPrefixes(*srcDir, cfg.Input.Encoding, *distributionFile, *occurrenceThreshold, cfg.Analysis.MinOutlierShare)
 
-	fmt.Printf("Patterns extracted to %s\n", distributionFile)
+	fmt.Printf("Patterns extracted to %s\n", *distributionFile)
+	return nil
 }
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// Parameters of the Punycode encoding of domain labels (RFC 3492).
+const (
+	punyBase        = 36
+	punyTMin        = 1
+	punyTMax        = 26
+	punySkew        = 38
+	punyDamp        = 700
+	punyInitialBias = 72
+	punyInitialN    = 128
+)
+
+// errPunycodeOverflow is returned for input whose code points do not fit the encoding.
+var errPunycodeOverflow = fmt.Errorf("punycode: overflow")
+
+// punyAdapt is the bias adaptation function of RFC 3492 section 6.1.
+func punyAdapt(delta, numPoints int32, first bool) int32 {
+	if first {
+		delta /= punyDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+	k := int32(0)
+	for delta > ((punyBase-punyTMin)*punyTMax)/2 {
+		delta /= punyBase - punyTMin
+		k += punyBase
+	}
+	return k + (punyBase-punyTMin+1)*delta/(delta+punySkew)
+}
+
+// punyThreshold returns the threshold t for the digit at position k.
+func punyThreshold(k, bias int32) int32 {
+	switch {
+	case k <= bias:
+		return punyTMin
+	case k >= bias+punyTMax:
+		return punyTMax
+	}
+	return k - bias
+}
+
+func punyDigit(d int32) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+func punyValue(c byte) (int32, bool) {
+	switch {
+	case c >= 'a' && c <= 'z':
+		return int32(c - 'a'), true
+	case c >= 'A' && c <= 'Z':
+		return int32(c - 'A'), true
+	case c >= '0' && c <= '9':
+		return int32(c-'0') + 26, true
+	}
+	return 0, false
+}
+
+// punycodeEncode returns the Punycode form of a label, without the "xn--" prefix.
+func punycodeEncode(label string) (string, error) {
+	runes := []rune(label)
+	var out []byte
+	for _, r := range runes {
+		if r < utf8.RuneSelf {
+			out = append(out, byte(r))
+		}
+	}
+	basic := int32(len(out))
+	handled := basic
+	if basic > 0 {
+		out = append(out, '-')
+	}
+
+	n, delta, bias := int32(punyInitialN), int32(0), int32(punyInitialBias)
+	for handled < int32(len(runes)) {
+		// The smallest code point not handled yet.
+		m := int32(math.MaxInt32)
+		for _, r := range runes {
+			if r >= n && r < m {
+				m = r
+			}
+		}
+		if m-n > (math.MaxInt32-delta)/(handled+1) {
+			return "", errPunycodeOverflow
+		}
+		delta += (m - n) * (handled + 1)
+		n = m
+		for _, r := range runes {
+			if r < n {
+				if delta++; delta < 0 {
+					return "", errPunycodeOverflow
+				}
+			}
+			if r != n {
+				continue
+			}
+			q := delta
+			for k := int32(punyBase); ; k += punyBase {
+				t := punyThreshold(k, bias)
+				if q < t {
+					break
+				}
+				out = append(out, punyDigit(t+(q-t)%(punyBase-t)))
+				q = (q - t) / (punyBase - t)
+			}
+			out = append(out, punyDigit(q))
+			bias = punyAdapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+		delta++
+		n++
+	}
+	return string(out), nil
+}
+
+// punycodeDecode returns the label encoded by a Punycode string given
+// without its "xn--" prefix.
+func punycodeDecode(encoded string) (string, error) {
+	var output []rune
+	pos := 0
+	if delim := strings.LastIndexByte(encoded, '-'); delim >= 0 {
+		for i := 0; i < delim; i++ {
+			if encoded[i] >= utf8.RuneSelf {
+				return "", fmt.Errorf("punycode: non-ASCII character in %q", encoded)
+			}
+			output = append(output, rune(encoded[i]))
+		}
+		pos = delim + 1
+	}
+
+	n, i, bias := int32(punyInitialN), int32(0), int32(punyInitialBias)
+	for pos < len(encoded) {
+		oldi, w := i, int32(1)
+		for k := int32(punyBase); ; k += punyBase {
+			if pos >= len(encoded) {
+				return "", fmt.Errorf("punycode: %q ends in the middle of a code point", encoded)
+			}
+			digit, ok := punyValue(encoded[pos])
+			pos++
+			if !ok {
+				return "", fmt.Errorf("punycode: invalid character %q", encoded[pos-1])
+			}
+			if digit > (math.MaxInt32-i)/w {
+				return "", errPunycodeOverflow
+			}
+			i += digit * w
+			t := punyThreshold(k, bias)
+			if digit < t {
+				break
+			}
+			if w > math.MaxInt32/(punyBase-t) {
+				return "", errPunycodeOverflow
+			}
+			w *= punyBase - t
+		}
+		x := int32(len(output) + 1)
+		bias = punyAdapt(i-oldi, x, oldi == 0)
+		if i/x > math.MaxInt32-n {
+			return "", errPunycodeOverflow
+		}
+		n += i / x
+		i %= x
+		if n > utf8.MaxRune || !utf8.ValidRune(n) {
+			return "", fmt.Errorf("punycode: invalid code point %#x", n)
+		}
+		output = append(output, 0)
+		copy(output[i+1:], output[i:])
+		output[i] = n
+		i++
+	}
+	return string(output), nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import "testing"
+
+// punycodeVectors are the sample strings of RFC 3492 section 7.1, plus a few
+// labels of the kind found in email domains.
+var punycodeVectors = []struct {
+	name, decoded, encoded string
+}{
+	{"A Arabic (Egyptian)", "ليهمابتكلموشعربي؟", "egbpdaj6bu4bxfgehfvwxn"},
+	{"B Chinese (simplified)", "他们为什么不说中文", "ihqwcrb4cv8a8dqg056pqjye"},
+	{"D Czech", "Pročprostěnemluvíčesky", "Proprostnemluvesky-uyb24dma41a"},
+	{"E Hebrew", "למההםפשוטלאמדבריםעברית", "4dbcagdahymbxekheh6e0a7fei0b"},
+	{"I Russian", "почемужеонинеговорятпорусски", "b1abfaaepdrnnbgefbadotcwatmq2g4l"},
+	{"J Spanish", "PorquénopuedensimplementehablarenEspañol", "PorqunopuedensimplementehablarenEspaol-fmd56a"},
+	{"K Vietnamese", "TạisaohọkhôngthểchỉnóitiếngViệt", "TisaohkhngthchnitingVit-kjcr8268qyxafd2f1b9g"},
+	{"L Japanese", "3年B組金八先生", "3B-ww4c5e180e575a65lsy2b"},
+	{"M Japanese", "安室奈美恵-with-SUPER-MONKEYS", "-with-SUPER-MONKEYS-pc58ag80a8qai00g7n9n"},
+	{"N Japanese", "Hello-Another-Way-それぞれの場所", "Hello-Another-Way--fc4qua05auwb3674vfr0b"},
+	{"O Japanese", "ひとつ屋根の下2", "2-u9tlzr9756bt3uc0v"},
+	{"P Japanese", "MajiでKoiする5秒前", "MajiKoi5-783gue6qz075azm5e"},
+	{"Q Japanese", "パフィーdeルンバ", "de-jg4avhby1noc0d"},
+	{"R Japanese", "そのスピードで", "d9juau41awczczp"},
+	{"S ASCII", "-> $1.00 <-", "-> $1.00 <--"},
+	{"German domain", "bücher", "bcher-kva"},
+	{"Russian domain", "рф", "p1ai"},
+}
+
+func TestPunycodeEncode(t *testing.T) {
+	for _, tt := range punycodeVectors {
+		got, err := punycodeEncode(tt.decoded)
+		if err != nil {
+			t.Errorf("%s: punycodeEncode(%q) returned error %v", tt.name, tt.decoded, err)
+			continue
+		}
+		if got != tt.encoded {
+			t.Errorf("%s: punycodeEncode(%q) = %q, want %q", tt.name, tt.decoded, got, tt.encoded)
+		}
+	}
+}
+
+func TestPunycodeDecode(t *testing.T) {
+	for _, tt := range punycodeVectors {
+		got, err := punycodeDecode(tt.encoded)
+		if err != nil {
+			t.Errorf("%s: punycodeDecode(%q) returned error %v", tt.name, tt.encoded, err)
+			continue
+		}
+		if got != tt.decoded {
+			t.Errorf("%s: punycodeDecode(%q) = %q, want %q", tt.name, tt.encoded, got, tt.decoded)
+		}
+	}
+}
+
+func TestPunycodeDecodeInvalid(t *testing.T) {
+	for _, encoded := range []string{
+		"bcher-kv!",   // not a base 36 digit
+		"bcher-k",     // ends in the middle of a code point
+		"bü-kva",      // non-ASCII basic code point
+		"99999999999", // code point out of range
+	} {
+		if decoded, err := punycodeDecode(encoded); err == nil {
+			t.Errorf("punycodeDecode(%q) = %q, want an error", encoded, decoded)
+		}
+	}
+}
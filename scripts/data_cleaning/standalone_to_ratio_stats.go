@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PrefixStats represents statistics for a single prefix
+type PrefixStats struct {
+	Prefix          string `json:"prefix"`
+	StandaloneCount int    `json:"standalone_count"`
+	FollowingCount  int    `json:"following_count"`
+}
+
+// collectPrefixStats gathers statistics for all prefixes with standalone count > threshold
+func collectPrefixStats(passTrie *Trie, threshold int) []PrefixStats {
+	var stats []PrefixStats
+	passTrie.walk(func(node int32, prefix []byte) {
+		if standalone := int(passTrie.nodes[node].endOfWordCount); standalone > threshold {
+			stats = append(stats, PrefixStats{
+				Prefix:          string(prefix),
+				StandaloneCount: standalone,
+				FollowingCount:  passTrie.followingCount(node),
+			})
+		}
+	})
+	return stats
+}
+
+func GeneratePrefixStatistics(srcDir, encoding string, outputFile string, occurrenceThreshold int) error {
+	// Create a map to store stats for each file
+	allStats := make(map[string][]PrefixStats)
+
+	// Process all password files first
+	err := filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if strings.HasSuffix(trimCompressionExt(info.Name()), "_passwords.txt") {
+			fmt.Printf("Processing file: %s\n", info.Name())
+
+			// Initialize trie for current file
+			passTrie := NewTrie()
+
+			// Load credentials for the current file
+			LoadCredentialsFromFile(path, encoding, passTrie)
+
+			// Collect statistics for this file's qualifying prefixes
+			stats := collectPrefixStats(passTrie, occurrenceThreshold)
+
+			// Store stats in map using filename as key
+			baseName := strings.TrimSuffix(trimCompressionExt(info.Name()), "_passwords.txt")
+			allStats[baseName] = stats
+		}
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// Create output file for writing JSON
+	file, err := os.Create(outputFile)
+	if err != nil {
+		return fmt.Errorf("error creating output file: %v", err)
+	}
+	defer file.Close()
+
+	// Write JSON with proper indentation
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "    ")
+	if err := encoder.Encode(allStats); err != nil {
+		return fmt.Errorf("error encoding JSON: %v", err)
+	}
+
+	return nil
+}
+
+// cmdRatioStats implements the ratio-stats subcommand.
+func cmdRatioStats(args []string) error {
+	fs := flag.NewFlagSet("ratio-stats", flag.ExitOnError)
+	configFile := configFlag(fs)
+	srcDir := fs.String("src", "../OrganizedPasswords", "directory containing *_passwords.txt files")
+	outputFile := fs.String("out", "prefix_statistics.json", "file to write the prefix statistics to")
+	occurrenceThreshold := fs.Int("threshold", 0, "minimum standalone occurrences for a prefix to be recorded (overrides the config)")
+	fs.Parse(args)
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	if !flagWasSet(fs, "threshold") {
+		*occurrenceThreshold = cfg.Analysis.RatioStatsThreshold
+	}
+
+	if err := GeneratePrefixStatistics(*srcDir, cfg.Input.Encoding, *outputFile, *occurrenceThreshold); err != nil {
+		return fmt.Errorf("error generating statistics: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"unicode/utf8"
+)
+
+// Trie counts words by prefix. Nodes are kept in one slice and refer to
+// their children by index. A node with one child, as most nodes below the
+// branching top of a password trie are, holds it inline; the children of a
+// node with several are kept in a separate array sorted by character. Every
+// node keeps the number of words in its subtree up to date as words are
+// inserted, so counting the words below a prefix does not walk the subtree.
+type Trie struct {
+	// nodes[0] is the root, the empty prefix.
+	nodes []trieNode
+	// fanout holds the children of the nodes with several; fanout[0] is unused.
+	fanout [][]trieEdge
+}
+
+// trieNode is the prefix spelled by the path from the root to it.
+type trieNode struct {
+	// endOfWordCount counts the words equal to the prefix, and wordCount the
+	// words starting with it, those included.
+	endOfWordCount uint64
+	wordCount      uint64
+	// only is the child of a node with exactly one; only.node is 0, the
+	// root, when the node has none or several.
+	only trieEdge
+	// fanout is the index in Trie.fanout of the children of a node with
+	// several, and 0 otherwise.
+	fanout int32
+}
+
+// trieEdge leads from a node to the child for the next character.
+type trieEdge struct {
+	char rune
+	node int32
+}
+
+// NewTrie creates and returns a new Trie.
+func NewTrie() *Trie {
+	return &Trie{nodes: []trieNode{{}}, fanout: [][]trieEdge{nil}}
+}
+
+// searchEdges returns the index of the first edge of children for a
+// character not below char.
+func searchEdges(children []trieEdge, char rune) int {
+	return sort.Search(len(children), func(i int) bool { return children[i].char >= char })
+}
+
+// child returns the child of node for char, and false if there is none.
+func (t *Trie) child(node int32, char rune) (int32, bool) {
+	n := &t.nodes[node]
+	if n.fanout == 0 {
+		return n.only.node, n.only.node != 0 && n.only.char == char
+	}
+	children := t.fanout[n.fanout]
+	if i := searchEdges(children, char); i < len(children) && children[i].char == char {
+		return children[i].node, true
+	}
+	return 0, false
+}
+
+// addChild adds a new child for char to node and returns it.
+func (t *Trie) addChild(node int32, char rune) int32 {
+	next := int32(len(t.nodes))
+	t.nodes = append(t.nodes, trieNode{})
+	edge := trieEdge{char: char, node: next}
+	n := &t.nodes[node]
+	switch {
+	case n.fanout == 0 && n.only.node == 0:
+		n.only = edge
+	case n.fanout == 0:
+		children := []trieEdge{n.only, edge}
+		if edge.char < n.only.char {
+			children[0], children[1] = edge, n.only
+		}
+		n.only = trieEdge{}
+		n.fanout = int32(len(t.fanout))
+		t.fanout = append(t.fanout, children)
+	default:
+		children := t.fanout[n.fanout]
+		i := searchEdges(children, char)
+		children = append(children, trieEdge{})
+		copy(children[i+1:], children[i:])
+		children[i] = edge
+		t.fanout[n.fanout] = children
+	}
+	return next
+}
+
+// children returns the children of node in order of their characters.
+func (t *Trie) children(node int32) []trieEdge {
+	n := &t.nodes[node]
+	if n.fanout != 0 {
+		return t.fanout[n.fanout]
+	}
+	if n.only.node != 0 {
+		return []trieEdge{n.only}
+	}
+	return nil
+}
+
+// Insert inserts a word into the Trie.
+func (t *Trie) Insert(word string) {
+	node := int32(0)
+	t.nodes[node].wordCount++
+	for _, char := range word {
+		next, exists := t.child(node, char)
+		if !exists {
+			next = t.addChild(node, char)
+		}
+		node = next
+		t.nodes[node].wordCount++
+	}
+	t.nodes[node].endOfWordCount++
+}
+
+// find returns the node of prefix, and false if no word starts with it.
+func (t *Trie) find(prefix string) (int32, bool) {
+	node := int32(0)
+	for _, char := range prefix {
+		next, exists := t.child(node, char)
+		if !exists {
+			return 0, false
+		}
+		node = next
+	}
+	return node, true
+}
+
+// CountWordsWithPrefix counts how many words share the given prefix.
+func (t *Trie) CountWordsWithPrefix(prefix string) int {
+	node, exists := t.find(prefix)
+	if !exists {
+		return 0
+	}
+	return int(t.nodes[node].wordCount)
+}
+
+// CountStandaloneOccurrences returns the end of word count for a specific prefix.
+func (t *Trie) CountStandaloneOccurrences(prefix string) int {
+	node, exists := t.find(prefix)
+	if !exists {
+		return 0
+	}
+	return int(t.nodes[node].endOfWordCount)
+}
+
+// followingCount returns how many words continue past the prefix of node.
+func (t *Trie) followingCount(node int32) int {
+	n := &t.nodes[node]
+	return int(n.wordCount - n.endOfWordCount)
+}
+
+// walk calls fn for every node of the trie with the prefix it spells, in
+// lexical order of the characters. The prefix is only valid during the call.
+func (t *Trie) walk(fn func(node int32, prefix []byte)) {
+	var walkNode func(node int32, prefix []byte)
+	walkNode = func(node int32, prefix []byte) {
+		fn(node, prefix)
+		n := t.nodes[node]
+		if n.fanout == 0 {
+			if n.only.node != 0 {
+				walkNode(n.only.node, utf8.AppendRune(prefix, n.only.char))
+			}
+			return
+		}
+		for _, edge := range t.fanout[n.fanout] {
+			walkNode(edge.node, utf8.AppendRune(prefix, edge.char))
+		}
+	}
+	walkNode(0, make([]byte, 0, 64))
+}
+
+// LoadCredentialsFromFile loads passwords from a file, decoded like the
+// cleaner decodes its input, and inserts them into the trie. Lines that are
+// not credentials are counted and reported once per file.
+func LoadCredentialsFromFile(filePath, encoding string, passTrie *Trie) {
+	lines, err := openLineReader(filePath, encoding)
+	if err != nil {
+		log.Printf("Error opening file %s: %v", filePath, err)
+		return
+	}
+	defer lines.Close()
+
+	unparsable := make(map[string]int)
+	for lines.Scan() {
+		_, password, reason, ok := parseCredentialLine(lines.Text())
+		if !ok {
+			unparsable[reason]++
+			continue
+		}
+		if password != "" {
+			passTrie.Insert(password)
+		}
+	}
+
+	if err := lines.Err(); err != nil {
+		log.Printf("Error reading file %s: %v", filePath, err)
+	}
+	log.Printf("Read %s as %s", filePath, lines.encoding)
+	for reason, count := range unparsable {
+		log.Printf("Skipped %d lines of %s that could not be parsed (%s)", count, filePath, reason)
+	}
+}
+
+// collectHighStandalone returns all prefixes with standalone occurrences above the threshold.
+func collectHighStandalone(passTrie *Trie, occurrenceThreshold int) []string {
+	var highStandalonePrefixes []string
+	passTrie.walk(func(node int32, prefix []byte) {
+		// If this node marks the end of a word and meets the threshold, add it to the results.
+		if int(passTrie.nodes[node].endOfWordCount) > occurrenceThreshold {
+			highStandalonePrefixes = append(highStandalonePrefixes, string(prefix))
+		}
+	})
+	return highStandalonePrefixes
+}
+
+// collectFollowingChars counts the occurrences of characters that follow the given prefix.
+func collectFollowingChars(passTrie *Trie, prefix string) map[rune]int {
+	followingCharCount := make(map[rune]int)
+
+	// Find the node for the given prefix
+	node, exists := passTrie.find(prefix)
+	if !exists {
+		return followingCharCount // Return empty if the prefix doesn't exist
+	}
+
+	// The count of each following character is the number of words below its child.
+	for _, edge := range passTrie.children(node) {
+		followingCharCount[edge.char] = int(passTrie.nodes[edge.node].wordCount)
+	}
+
+	return followingCharCount
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestTrieCounts(t *testing.T) {
+	trie := NewTrie()
+	for _, word := range []string{"pass", "pass", "password", "passw0rd", "pa", "qwerty", "", "пароль", "парус"} {
+		trie.Insert(word)
+	}
+	tests := []struct {
+		prefix     string
+		words      int
+		standalone int
+	}{
+		{"", 9, 1},
+		{"p", 5, 0},
+		{"pa", 5, 1},
+		{"pass", 4, 2},
+		{"passw", 2, 0},
+		{"password", 1, 1},
+		{"passwords", 0, 0},
+		{"q", 1, 0},
+		{"x", 0, 0},
+		{"пар", 2, 0},
+		{"пароль", 1, 1},
+	}
+
+	for _, tt := range tests {
+		if got := trie.CountWordsWithPrefix(tt.prefix); got != tt.words {
+			t.Errorf("CountWordsWithPrefix(%q) = %d, want %d", tt.prefix, got, tt.words)
+		}
+		if got := trie.CountStandaloneOccurrences(tt.prefix); got != tt.standalone {
+			t.Errorf("CountStandaloneOccurrences(%q) = %d, want %d", tt.prefix, got, tt.standalone)
+		}
+		if node, exists := trie.find(tt.prefix); exists {
+			if got := trie.followingCount(node); got != tt.words-tt.standalone {
+				t.Errorf("followingCount(%q) = %d, want %d", tt.prefix, got, tt.words-tt.standalone)
+			}
+		}
+	}
+}
+
+// TestTrieMatchesMap checks the trie against counts kept in maps, over words
+// whose nodes have one child, a few or many, inserted in random order.
+func TestTrieMatchesMap(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	alphabet := []rune("ab01zéжあ")
+	words := make(map[string]int)
+	prefixes := make(map[string]int)
+	trie := NewTrie()
+	for i := 0; i < 5000; i++ {
+		word := make([]rune, rnd.Intn(6))
+		for j := range word {
+			word[j] = alphabet[rnd.Intn(len(alphabet))]
+		}
+		// Long shared stems make chains of nodes with a single child.
+		if rnd.Intn(4) == 0 {
+			word = append([]rune("longsharedstem"), word...)
+		}
+		s := string(word)
+		trie.Insert(s)
+		words[s]++
+		for j := 0; j <= len(word); j++ {
+			prefixes[string(word[:j])]++
+		}
+	}
+
+	for prefix, want := range prefixes {
+		if got := trie.CountWordsWithPrefix(prefix); got != want {
+			t.Fatalf("CountWordsWithPrefix(%q) = %d, want %d", prefix, got, want)
+		}
+		if got := trie.CountStandaloneOccurrences(prefix); got != words[prefix] {
+			t.Fatalf("CountStandaloneOccurrences(%q) = %d, want %d", prefix, got, words[prefix])
+		}
+	}
+
+	// walk visits every prefix once, in lexical order, and children are
+	// kept sorted by character.
+	var walked []string
+	trie.walk(func(node int32, prefix []byte) {
+		walked = append(walked, string(prefix))
+		children := trie.children(node)
+		if !sort.SliceIsSorted(children, func(i, j int) bool { return children[i].char < children[j].char }) {
+			t.Errorf("children of %q are not sorted: %v", prefix, children)
+		}
+	})
+	want := make([]string, 0, len(prefixes))
+	for prefix := range prefixes {
+		want = append(want, prefix)
+	}
+	sort.Strings(want)
+	if !reflect.DeepEqual(walked, want) {
+		t.Errorf("walk visited %d prefixes, want the %d sorted prefixes", len(walked), len(want))
+	}
+	if len(trie.nodes) != len(prefixes) {
+		t.Errorf("trie has %d nodes, want one per prefix, %d", len(trie.nodes), len(prefixes))
+	}
+}